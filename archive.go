@@ -0,0 +1,153 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// inputExtensions は入力画像として扱うファイルの拡張子です。アーカイブ内のエントリはこの拡張子のものだけを展開します。
+// .jpe, .jfif, .jifはJPEGの別名の拡張子です。出力の拡張子はデコードした形式から決まるため、これらの入力も.jpgで出力します。
+var inputExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".jpe":  true,
+	".jfif": true,
+	".jif":  true,
+	".png":  true,
+}
+
+// maxArchiveEntryBytes は展開するアーカイブのエントリ1つあたりのバイト数の上限です。
+// 圧縮率の極端に高いエントリでディスクを使い切らないよう、超えた時点で展開を中止します。
+var maxArchiveEntryBytes int64 = 256 << 20
+
+// archiveEntry はアーカイブから展開した画像ファイルです。
+type archiveEntry struct {
+	// Name はアーカイブ内でのパス(/区切り)です。
+	Name string
+	// Path は展開先のパスです。
+	Path string
+}
+
+// extractArchive はarchivePathのZIPまたはtar(.tar, .tar.gz, .tgz)アーカイブに含まれる画像ファイルをdirの下に展開します。
+// アーカイブ内のディレクトリ構成はそのまま再現し、更新日時もエントリのものにします。
+// inputExtensionsにない拡張子のエントリと、dirの外を指すパスのエントリは展開しません。
+func extractArchive(archivePath, dir string) ([]archiveEntry, error) {
+	name := strings.ToLower(archivePath)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return extractZip(archivePath, dir)
+	case strings.HasSuffix(name, ".tar"):
+		return extractTar(archivePath, dir, false)
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return extractTar(archivePath, dir, true)
+	}
+	return nil, errors.New("unsupported archive format (zip, tar, tar.gz and tgz are supported)")
+}
+
+func extractZip(archivePath, dir string) ([]archiveEntry, error) {
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var entries []archiveEntry
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || !isArchiveImage(f.Name) {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return entries, err
+		}
+		entry, err := extractEntry(rc, f.Name, dir, f.Modified)
+		rc.Close()
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func extractTar(archivePath, dir string, gzipped bool) ([]archiveEntry, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if gzipped {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var entries []archiveEntry
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return entries, err
+		}
+		if hdr.Typeflag != tar.TypeReg || !isArchiveImage(hdr.Name) {
+			continue
+		}
+		entry, err := extractEntry(tr, hdr.Name, dir, hdr.ModTime)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// isArchiveImage はアーカイブ内のnameが展開する画像ファイルかどうかを返します。
+func isArchiveImage(name string) bool {
+	return filepath.IsLocal(filepath.FromSlash(name)) && inputExtensions[strings.ToLower(path.Ext(name))]
+}
+
+// extractEntry はrの内容をdirの下のnameに書き出します。
+// 内容がmaxArchiveEntryBytesを超える場合は、書きかけのファイルを削除してエラーを返します。
+func extractEntry(r io.Reader, name, dir string, modTime time.Time) (archiveEntry, error) {
+	dst := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return archiveEntry{}, err
+	}
+	f, err := os.Create(dst)
+	if err != nil {
+		return archiveEntry{}, err
+	}
+	// 上限より1バイト多く読めた場合に、上限を超えたと判断する。
+	n, err := io.Copy(f, io.LimitReader(r, maxArchiveEntryBytes+1))
+	if err == nil && n > maxArchiveEntryBytes {
+		err = fmt.Errorf("%s: archive entry is larger than %d bytes", name, maxArchiveEntryBytes)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst)
+		return archiveEntry{}, err
+	}
+	if !modTime.IsZero() {
+		if err := os.Chtimes(dst, modTime, modTime); err != nil {
+			return archiveEntry{}, err
+		}
+	}
+	return archiveEntry{Name: path.Clean(name), Path: dst}, nil
+}
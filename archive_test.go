@@ -0,0 +1,140 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsArchiveImage(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"a.jpg", true},
+		{"dir/a.JPEG", true},
+		{"a.jpe", true},
+		{"a.jfif", true},
+		{"photos/a.JFIF", true},
+		{"a.jif", true},
+		{"a.png", true},
+		{"a.gif", false},
+		{"readme.txt", false},
+		{"../a.jfif", false},
+	}
+	for _, tt := range tests {
+		if got := isArchiveImage(tt.name); got != tt.want {
+			t.Errorf("isArchiveImage(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExtractZipJFIF(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "in.zip")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for _, name := range []string{"a.jfif", "sub/b.jif", "notes.txt"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte("data"))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	entries, err := extractArchive(archive, filepath.Join(dir, "x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	if len(names) != 2 || names[0] != "a.jfif" || names[1] != "sub/b.jif" {
+		t.Errorf("extracted %q, want [a.jfif sub/b.jif]", names)
+	}
+}
+
+func TestExtractEntryLimit(t *testing.T) {
+	defer func(n int64) { maxArchiveEntryBytes = n }(maxArchiveEntryBytes)
+	maxArchiveEntryBytes = 1 << 20
+
+	tests := []struct {
+		name    string
+		archive string
+		size    int64
+		wantErr bool
+	}{
+		{"zip at limit", "in.zip", 1 << 20, false},
+		{"zip over limit", "in.zip", 64 << 20, true},
+		{"tgz over limit", "in.tgz", 64 << 20, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			archive := filepath.Join(dir, tt.archive)
+			// 0だけのエントリはよく圧縮されるため、小さなアーカイブから大きなファイルが展開される。
+			zeros := bytes.NewReader(make([]byte, tt.size))
+			var buf bytes.Buffer
+			if filepath.Ext(archive) == ".zip" {
+				zw := zip.NewWriter(&buf)
+				w, err := zw.Create("bomb.png")
+				if err != nil {
+					t.Fatal(err)
+				}
+				zeros.WriteTo(w)
+				if err := zw.Close(); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				gz := gzip.NewWriter(&buf)
+				tw := tar.NewWriter(gz)
+				if err := tw.WriteHeader(&tar.Header{Name: "bomb.png", Mode: 0644, Size: tt.size}); err != nil {
+					t.Fatal(err)
+				}
+				zeros.WriteTo(tw)
+				if err := tw.Close(); err != nil {
+					t.Fatal(err)
+				}
+				if err := gz.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if buf.Len() > 1<<20 {
+				t.Fatalf("archive is %d bytes, want a highly compressed entry", buf.Len())
+			}
+			if err := os.WriteFile(archive, buf.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			out := filepath.Join(dir, "x")
+			entries, err := extractArchive(archive, out)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("extracted %d entries, want an error", len(entries))
+				}
+				if _, err := os.Stat(filepath.Join(out, "bomb.png")); !os.IsNotExist(err) {
+					t.Errorf("partial entry is left behind: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi, err := os.Stat(filepath.Join(out, "bomb.png")); err != nil || fi.Size() != tt.size {
+				t.Errorf("extracted entry: %v, %v, want %d bytes", fi, err, tt.size)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/chikin14niwa/image-resizer/resizer"
+)
+
+// cacheIgnoredFlags は-cacheFileの設定の指紋に含めない、入力の選び方や表示だけに関わるフラグです。
+var cacheIgnoredFlags = map[string]bool{
+	"inputFiles": true, "inputList": true, "inputArchive": true, "sampleEveryNth": true,
+	"cacheFile": true, "checkpoint": true, "progress": true, "stats": true, "jsonl": true, "orderedOutput": true,
+	"workers": true, "maxConcurrentDecodes": true, "failFast": true, "fileTimeout": true, "timeoutTotal": true,
+	"cpuprofile": true, "memprofile": true,
+}
+
+// cacheSettings は指定されたフラグのうち出力に関わるものから、設定の指紋を作ります。
+// 設定を変えて実行し直した場合に、前の設定の出力で読み飛ばさないようにするためのものです。
+func cacheSettings() string {
+	var items []string
+	flag.Visit(func(f *flag.Flag) {
+		if !cacheIgnoredFlags[f.Name] {
+			items = append(items, f.Name+"="+f.Value.String())
+		}
+	})
+	sort.Strings(items)
+	sum := sha256.Sum256([]byte(strings.Join(items, "\n")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// cacheEntry は-cacheFileに1行ずつ書き込む、1つの入力ファイルの記録です。
+type cacheEntry struct {
+	Source   string   `json:"source"`
+	Size     int64    `json:"size"`
+	ModTime  int64    `json:"modTime"`
+	SHA256   string   `json:"sha256"`
+	Settings string   `json:"settings"`
+	Outputs  []string `json:"outputs"`
+}
+
+// resultCache は-cacheFileで、変換した入力ファイルの大きさ・更新日時・内容のハッシュと出力ファイルを記録するファイルです。
+// 記録は1行に1つのJSONで追記し、同じ入力ファイルは後の行を使います。複数のgoroutineから同時に使えます。
+type resultCache struct {
+	mu       sync.Mutex
+	f        *os.File
+	settings string
+	entries  map[string]cacheEntry
+}
+
+// openResultCache はpathの記録を読み込み、続きを追記できるように開きます。pathがない場合は新しく作ります。
+// 途中で書き込みが止まった行や壊れた行は、その入力ファイルの記録がないものとして無視します。
+func openResultCache(path, settings string) (*resultCache, error) {
+	c := &resultCache{settings: settings, entries: map[string]cacheEntry{}}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	sc := bufio.NewScanner(strings.NewReader(string(data)))
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var e cacheEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err == nil && e.Source != "" {
+			c.entries[e.Source] = e
+		}
+	}
+
+	c.f, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	// 途中で終わった行の後ろに続けて書かないよう、改行で区切っておく。
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		if _, err := c.f.WriteString("\n"); err != nil {
+			c.f.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// fresh はkeyで記録したsrcPathが同じ設定で変換済みで、その後変わっておらず、出力ファイルがすべて残っているかを返します。
+// 大きさと更新日時が記録と同じ場合はそのまま、更新日時だけが違う場合は内容のハッシュを比べます。
+// ハッシュで同じと確かめた場合は、次回はハッシュを計算しないよう更新日時を記録し直します。
+func (c *resultCache) fresh(key, srcPath string) bool {
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if !ok || e.Settings != c.settings || len(e.Outputs) == 0 {
+		return false
+	}
+	fi, err := os.Stat(srcPath)
+	if err != nil || fi.Size() != e.Size {
+		return false
+	}
+	for _, p := range e.Outputs {
+		if _, err := os.Stat(p); err != nil {
+			return false
+		}
+	}
+	if fi.ModTime().UnixNano() == e.ModTime {
+		return true
+	}
+	sum, err := fileSHA256(srcPath)
+	if err != nil || sum != e.SHA256 {
+		return false
+	}
+	e.ModTime = fi.ModTime().UnixNano()
+	c.write(e)
+	return true
+}
+
+// record はrの入力ファイルを、rの出力ファイルとともにkeyで変換済みとして記録します。
+// keyは通常は入力ファイルの絶対パスで、アーカイブから展開したファイルでは展開先が毎回変わるため"アーカイブ:エントリ名"を使います。
+func (c *resultCache) record(key string, r *resizer.Result) error {
+	fi, err := os.Stat(r.SourcePath)
+	if err != nil {
+		return err
+	}
+	sum, err := fileSHA256(r.SourcePath)
+	if err != nil {
+		return err
+	}
+	e := cacheEntry{
+		Source:   key,
+		Size:     fi.Size(),
+		ModTime:  fi.ModTime().UnixNano(),
+		SHA256:   sum,
+		Settings: c.settings,
+	}
+	for _, p := range r.OutputPaths() {
+		e.Outputs = append(e.Outputs, checkpointKey(p))
+	}
+	return c.write(e)
+}
+
+// write はeを1行のJSONとして1回のWriteで追記し、記録を更新します。
+func (c *resultCache) write(e cacheEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	c.entries[e.Source] = e
+	return nil
+}
+
+// Close は記録のファイルを閉じます。
+func (c *resultCache) Close() error {
+	return c.f.Close()
+}
+
+// fileSHA256 はpathのファイルの内容のSHA-256を16進数で返します。
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
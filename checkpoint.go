@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// checkpoint は-checkpointで、処理が終わった入力ファイルを記録するファイルです。
+// 1行に1つ、入力ファイルの絶対パスを書き込みます。複数のgoroutineから同時に記録できます。
+type checkpoint struct {
+	mu   sync.Mutex
+	f    *os.File
+	done map[string]bool
+}
+
+// openCheckpoint はpathの記録を読み込み、続きを追記できるように開きます。pathがない場合は新しく作ります。
+// 書き込みの途中で中断され改行で終わっていない最後の行は、記録が完了していないものとして無視します。
+func openCheckpoint(path string) (*checkpoint, error) {
+	c := &checkpoint{done: map[string]bool{}}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	complete, partial := string(data), ""
+	if i := strings.LastIndexByte(complete, '\n'); i+1 < len(complete) {
+		complete, partial = complete[:i+1], complete[i+1:]
+	}
+	sc := bufio.NewScanner(strings.NewReader(complete))
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		if line := sc.Text(); line != "" {
+			c.done[line] = true
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	c.f, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	// 途中で終わった行の後ろに続けて書かないよう、改行で区切っておく。
+	if partial != "" {
+		if _, err := c.f.WriteString("\n"); err != nil {
+			c.f.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// checkpointKey はpathを記録に使う絶対パスにします。
+func checkpointKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// has はpathが前回までに処理を終えたファイルとして記録されているかを返します。
+func (c *checkpoint) has(path string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.done[checkpointKey(path)]
+}
+
+// record はpathを処理が終わったファイルとして記録します。
+// 途中で強制終了されても記録が失われないよう、書き込むたびにディスクへ同期します。
+func (c *checkpoint) record(path string) error {
+	key := checkpointKey(path)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.done[key] {
+		return nil
+	}
+	if _, err := c.f.WriteString(key + "\n"); err != nil {
+		return err
+	}
+	if err := c.f.Sync(); err != nil {
+		return err
+	}
+	c.done[key] = true
+	return nil
+}
+
+// Close は記録のファイルを閉じます。
+func (c *checkpoint) Close() error {
+	return c.f.Close()
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// -checksumで指定できるハッシュの種類です。チェックサムのファイルの拡張子にもなります。
+const (
+	CHECKSUM_SHA256 = "sha256"
+	CHECKSUM_MD5    = "md5"
+)
+
+var checksumAlgorithms = map[string]func() hash.Hash{
+	CHECKSUM_SHA256: sha256.New,
+	CHECKSUM_MD5:    md5.New,
+}
+
+// writeChecksum はpathのファイルのハッシュを、隣の"出力ファイル名.sha256"(md5の場合は".md5")に書き出します。
+// 中身はsha256sum, md5sumと同じ"ハッシュ  ファイル名"の1行で、そのディレクトリで"sha256sum -c"によって確かめられます。
+func writeChecksum(path, algorithm string) error {
+	newHash, ok := checksumAlgorithms[algorithm]
+	if !ok {
+		return fmt.Errorf("unknown checksum algorithm %q", algorithm)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := newHash()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	line := fmt.Sprintf("%s  %s\n", hex.EncodeToString(h.Sum(nil)), filepath.Base(path))
+	return os.WriteFile(path+"."+algorithm, []byte(line), 0644)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/chikin14niwa/image-resizer/resizer"
+)
+
+// removeSource は出力ファイルが書き込まれていることを確認してから、rの入力ファイルを削除します。
+// 出力ファイルが見つからない場合や、出力ファイルが入力ファイルそのもの(リンクを含む)の場合は削除しません。
+func removeSource(r *resizer.Result) error {
+	src, err := os.Stat(r.SourcePath)
+	if err != nil {
+		return err
+	}
+	for _, p := range r.OutputPaths() {
+		out, err := os.Stat(p)
+		if err != nil {
+			return fmt.Errorf("output is not written: %w", err)
+		}
+		if os.SameFile(src, out) {
+			return fmt.Errorf("output %s is the source file itself", p)
+		}
+	}
+	return os.Remove(r.SourcePath)
+}
@@ -0,0 +1,15 @@
+module github.com/chikin14niwa/image-resizer
+
+go 1.26.0
+
+require (
+	github.com/gen2brain/jpegli v0.4.2
+	github.com/gen2brain/webp v0.6.4
+	golang.org/x/image v0.46.0
+)
+
+require (
+	github.com/ebitengine/purego v0.10.1 // indirect
+	github.com/tetratelabs/wazero v1.12.0 // indirect
+	golang.org/x/sys v0.48.0 // indirect
+)
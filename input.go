@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// readInputList は1行に1ファイルのパスを書いたファイルを読み込みます。
+// 空行と、先頭が#の行(前後の空白は無視します)は読み飛ばします。
+func readInputList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var files []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		files = append(files, line)
+	}
+	return files, scanner.Err()
+}
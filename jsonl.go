@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/chikin14niwa/image-resizer/resizer"
+)
+
+// jsonlRecord は-jsonlで1行に書き出す1ファイル分の結果です。失敗したファイルはErrorにエラーの内容が入ります。
+type jsonlRecord struct {
+	resizer.Result
+	Error string `json:"error,omitempty"`
+}
+
+// writeJSONLine はrを1行のJSONとしてwに書き出します。
+// 1行を1回のWriteで書き出すため、途中で止まっても書き終えた行はそれぞれ単独で読み込めます。
+func writeJSONLine(w io.Writer, r resizer.Result) error {
+	rec := jsonlRecord{Result: r}
+	if r.Err != nil {
+		rec.Error = r.Err.Error()
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
@@ -1,148 +1,912 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"image"
-	"image/jpeg"
-	"image/png"
-	"io"
+	"image/color"
+	"math"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"golang.org/x/image/draw"
-)
 
-const (
-	TYPE_JPG = "jpeg"
-	TYPE_PNG = "png"
+	"github.com/chikin14niwa/image-resizer/resizer"
 )
 
-func ResizeImage(srcPath string, w, h int, outputDir, suffix string) error {
-	// 画像ファイルを開く
-	src, err := os.Open(srcPath)
+// parseSize は"800x600", "800x", "x600"形式の文字列を幅と高さに分解します。省略された側は0を返します。
+func parseSize(s string) (int, int, error) {
+	ws, hs, ok := strings.Cut(strings.ToLower(s), "x")
+	if !ok {
+		return 0, 0, fmt.Errorf("%q is not WxH format", s)
+	}
+	if ws == "" && hs == "" {
+		return 0, 0, fmt.Errorf("%q has neither width nor height", s)
+	}
+	var dims [2]int
+	for i, v := range []string{ws, hs} {
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return 0, 0, fmt.Errorf("%q is not a positive integer", v)
+		}
+		dims[i] = n
+	}
+	return dims[0], dims[1], nil
+}
+
+// referenceSize はpathの画像のヘッダから幅と高さを読み取ります。画像全体はデコードしません。
+func referenceSize(path string) (int, int, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return err
+		return 0, 0, err
 	}
-	defer src.Close()
+	defer f.Close()
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, 0, err
+	}
+	return cfg.Width, cfg.Height, nil
+}
 
-	// image.Decodeのunexpected EOF対策
-	imgHeader := bytes.NewBuffer(nil)
-	r := io.TeeReader(src, imgHeader)
+// dedupeInputs は絶対パスが同じ入力ファイルを最初に現れたものだけ残して取り除きます。
+// inputListは表示用の指定どおりのパス、fileListはbaseDirを反映したパスで、同じ順に並んでいる必要があります。
+func dedupeInputs(inputList, fileList []string) ([]string, []string) {
+	seen := make(map[string]bool, len(fileList))
+	var inputs, files []string
+	for i, p := range fileList {
+		key := p
+		if abs, err := filepath.Abs(p); err == nil {
+			key = abs
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		inputs = append(inputs, inputList[i])
+		files = append(files, p)
+	}
+	if removed := len(fileList) - len(files); removed > 0 {
+		fmt.Printf("[INFO] 重複した入力ファイルを%d件除外しました。\n", removed)
+	}
+	return inputs, files
+}
 
-	_, t, err := image.DecodeConfig(r)
-	if err != nil {
-		return err
+// sampleInputs は入力ファイルの1番目から数えてnファイルごとに1ファイル(1, n+1, 2n+1番目…)だけを残します。
+// inputList, fileListはdedupeInputsと同じく同じ順に並んでいる必要があります。
+func sampleInputs(inputList, fileList []string, n int) ([]string, []string) {
+	var inputs, files []string
+	for i := 0; i < len(fileList); i += n {
+		inputs = append(inputs, inputList[i])
+		files = append(files, fileList[i])
 	}
+	fmt.Printf("[INFO] %dファイルから%dファイルごとに1つ、%dファイルを処理します。\n", len(fileList), n, len(files))
+	return inputs, files
+}
 
-	if t != TYPE_JPG && t != TYPE_PNG {
-		return errors.New("This method only run jpeg and png")
+func main() {
+	// コマンドライン引数の設定
+	var (
+		outputDir         = flag.String("outputDir", "output", "リサイズ後の出力先を指定します。ない場合は作ります。空文字(-outputDir \"\")を指定すると入力ファイルと同じディレクトリに出力します。この場合はsuffixの指定が必要です。")
+		width             = flag.Int("width", 0, "リサイズ後の画像サイズです。-1を指定した場合、高さと元の縦横比から自動で計算されます(heightに1以上の指定が必要です)。")
+		height            = flag.Int("height", 0, "リサイズ後の画像サイズです。-1を指定した場合、幅と元の縦横比から自動で計算されます(widthに1以上の指定が必要です)。")
+		size              = flag.String("size", "", "リサイズ後の画像サイズを\"幅x高さ\"の形式でまとめて指定します。例: 800x600, 800x, x600。省略した側は自動で計算されます。width, heightと同時に指定された場合はこちらが優先されます。")
+		inputFiles        = flag.String("inputFiles", "", "画像変換するファイルです。,区切りで複数ファイルを指定できます。baseDirオプションを使用することで、相対位置を変更することができます。")
+		inputListFile     = flag.String("inputList", "", "画像変換するファイルを1行に1つずつ書いたテキストファイルです。#で始まる行と空行は無視されます。inputFilesと同時に指定した場合は両方を処理します。相対パスにはbaseDirが適用されます。")
+		inputArchive      = flag.String("inputArchive", "", "画像変換するファイルをまとめたZIPまたはtar(.tar, .tar.gz, .tgz)アーカイブです。含まれる画像(jpg, jpeg, jpe, png)をすべて変換し、それ以外のファイルは無視します。inputFiles, inputListとは同時に指定できません。preserveStructureを指定するとアーカイブ内のディレクトリ構成を再現します。展開後に256MiBを超えるエントリがある場合はエラーになります。")
+		baseDir           = flag.String("baseDir", "", "入力ファイルの基準となるディレクトリ位置です。デフォルトは実行ファイルを実行した位置です。")
+		suffix            = flag.String("suffix", "", "変換後の画像名にsuffixで指定した文字列を付与します。例: -sufix _resized A01.jpg -> A01_resized.jpg")
+		sanitizeNames     = flag.Bool("sanitizeNames", false, "suffix, sequenceに含まれるWindowsのファイル名に使えない文字(<>:\"|?*)を_に置き換えます。指定しない場合はエラーになります。パス区切り(/, \\)は置き換えずにエラーにします。")
+		keepAspect        = flag.Bool("keepAspectRatio", true, "width, heightを両方指定した場合に縦横比を保ち、その範囲に収まるサイズにリサイズします。縦横比を無視して指定サイズちょうどに変形させる場合は-keepAspectRatio=falseを指定します。")
+		strictAspect      = flag.Bool("strictAspect", false, "-keepAspectRatio=falseでwidth, heightを両方指定した場合に、その縦横比が元の画像(aspectで切り抜いた場合は切り抜いた範囲)と1%以上違うファイルは変形させずにエラーにします。")
+		matchSize         = flag.String("matchSize", "", "基準にする画像ファイルのパスです。その画像の幅・高さをwidth, heightとしてすべての入力画像をリサイズします。keepAspectRatioも通常どおり適用されます。width, height, size, megapixels, scaleX, scaleYとは同時に指定できません。")
+		megapixels        = flag.Float64("megapixels", 0, "縦横比を保ったまま、指定した画素数(百万画素単位)になるようにリサイズします。例: 12で約1200万画素。width, height, sizeとは同時に指定できません。")
+		scaleX            = flag.Float64("scaleX", 0, "元の画像の幅に掛ける倍率です。例: -scaleX 1 -scaleY 0.8。縦横比を保たずに幅・高さを別々の倍率で変換し、結果は四捨五入されます。指定しない側は1倍になります。width, height, size, megapixelsとは同時に指定できません。")
+		scaleY            = flag.Float64("scaleY", 0, "元の画像の高さに掛ける倍率です。scaleXを参照してください。")
+		outFormat         = flag.String("outFormat", "", "出力形式です。jpeg, png, webpから指定します。smallestを指定すると、jpeg, webp, pngでエンコードしたうち最もファイルサイズが小さい形式で出力します(透過がある画像ではjpegは選ばれません)。auto-smartを指定すると、縮小後の画像の内容から写真はJPEG、図やイラストはPNGで出力します(透過がある、色数がautoFormatColors以下、または右隣と同じ色の画素の割合がautoFormatFlat以上の場合にPNGになります)。省略した場合は入力と同じ形式で出力します。")
+		autoFormatColors  = flag.Int("autoFormatColors", resizer.DefaultAutoFormatMaxColors, "outFormat auto-smartで、色数がこの数以下の画像をPNG(図)とします。")
+		autoFormatFlat    = flag.Float64("autoFormatFlat", resizer.DefaultAutoFormatFlatRatio, "outFormat auto-smartで、右隣と同じ色の画素の割合(0〜1)がこの値以上の画像をPNG(図)とします。")
+		quality           = flag.String("quality", strconv.Itoa(resizer.DefaultQuality), "JPEG, WebP(非可逆)出力時の品質です。1〜100の整数で指定します。\"jpeg=85,webp=80\"のように形式ごとに指定することもでき、\"85,webp=80\"のように共通の値と組み合わせた場合は指定のない形式に共通の値を使います。autoを指定すると、元の画像とのSSIMがssim以上になる最も低い品質を自動で選びます(品質ごとに最大7回エンコードします)。")
+		ssimTarget        = flag.Float64("ssim", resizer.DefaultSSIM, "-quality autoで目標とするSSIM(0〜1)です。1に近いほど高画質になります。")
+		webpLossless      = flag.Bool("webpLossless", false, "WebPを可逆圧縮で出力します。線画など画素を正確に残したい場合に使います。qualityは無視されます。")
+		chroma            = flag.String("chromaSubsampling", resizer.DefaultChromaSubsampling, "JPEG出力時の色差サブサンプリングです。444, 440, 422, 420から指定します。420以外はjpegliタグ付きでビルドした場合のみ有効で、タグなしでビルドした場合は警告を表示して420で出力します。")
+		maxPixels         = flag.Int64("maxPixels", resizer.DefaultMaxPixels, "入力画像の画素数(幅×高さ)の上限です。超える画像は読み込まずにエラーとします。0以下を指定すると制限しません。")
+		showStats         = flag.Bool("stats", false, "終了時に処理したファイル数、入出力の合計バイト数、経過時間と1ファイルあたりの平均時間を表示します。")
+		cpuProfile        = flag.String("cpuprofile", "", "バッチ処理中のCPUプロファイル(pprof形式)を書き出すファイルのパスです。")
+		memProfile        = flag.String("memprofile", "", "バッチ処理の終了時点のメモリプロファイル(pprof形式)を書き出すファイルのパスです。")
+		inspect           = flag.Bool("inspect", false, "ファイルを書き出さずに、各ファイルの元のサイズ・形式・カラーモデル・透過の有無と、変換後のサイズを表示します。")
+		progress          = flag.Bool("progress", false, "各ファイルの処理が終わるたびに、\"[終わったファイル数/全体のファイル数] ファイルのパス\"を表示します。")
+		failFast          = flag.Bool("failFast", false, "いずれかのファイルでエラーが発生した時点で、残りのファイルを処理せずに異常終了します。指定しない場合はエラーを表示して次のファイルの処理を続けます。")
+		skipUnsupported   = flag.Bool("skipUnsupported", false, "入力の形式がjpeg, png以外のファイルをエラーとして表示せずに読み飛ばします。failFastを指定していても処理を続けます。読み飛ばしたファイルの数はstatsに表示されます。")
+		copyUnsupported   = flag.Bool("copyUnsupported", false, "入力の形式がjpeg, png以外のファイルや画像でないファイルを、リサイズせずに出力先へ同じファイル名でそのままコピーします。preserveStructureと組み合わせると、入力と同じ構成の出力ディレクトリを作れます。skipUnsupported, replaceとは同時に指定できません。outputDirを空にした場合は使えません。")
+		minBytes          = flag.Int64("onlyLargerThanBytes", 0, "ファイルサイズがこのバイト数を超える画像だけをリサイズし、それ以外は読み込まずに読み飛ばします。例: 1000000。onlyWiderThanと同時に指定した場合は、どちらか一方を超えていればリサイズします。")
+		minWidth          = flag.Int("onlyWiderThan", 0, "幅がこのpx数を超える画像だけをリサイズし、それ以外は画像全体を読み込まずに読み飛ばします。例: 2000。")
+		copySkipped       = flag.Bool("copySkipped", false, "onlyLargerThanBytes, onlyWiderThanで読み飛ばした画像を、出力先へ同じファイル名でそのままコピーします。replaceとは同時に指定できません。")
+		workers           = flag.Int("workers", 1, "同時に処理するファイル数です。2以上を指定した場合、sequenceの連番は入力の順番で振られ、失敗したファイルの番号は欠番になります。")
+		maxDecodes        = flag.Int("maxConcurrentDecodes", 0, "同時にデコードして縮小する画像の数の上限です。workersを増やしても、元のサイズの画像を展開している数をこの数までに抑えてメモリの使用量を制限します。0の場合はworkersと同じになります。")
+		fileTimeout       = flag.Duration("fileTimeout", 0, "1ファイルあたりの処理時間の上限です。例: 30s。超えたファイルはタイムアウトのエラーとし、残りのファイルの処理を続けます。0の場合は制限しません。")
+		timeoutTotal      = flag.Duration("timeoutTotal", 0, "バッチ全体の処理時間の上限です。例: 10m。超えた時点で残りのファイル(処理中のファイルを含む)の処理を中止し、処理できたファイル数と中止したファイル数を表示して異常終了します。0の場合は制限しません。")
+		ico               = flag.Bool("ico", false, "16x16, 32x32, 48x48の画像をまとめたファビコン用の.icoファイルを出力します。width, heightの指定は不要です。")
+		writeSidecar      = flag.Bool("writeSidecar", false, "出力画像と同じ場所に、入力パス・元のサイズ・出力サイズ・形式・品質を記録した\"出力ファイル名.json\"を書き出します。")
+		trimTransparent   = flag.Bool("trimTransparent", false, "PNGなど透過のある画像で、上下左右の完全に透明な余白を切り取ってからリサイズします。")
+		roundTo           = flag.Int("roundTo", 0, "縦横比を保って計算した幅・高さを、それぞれ指定した数の倍数のうち最も近いものに丸めます。例: -roundTo 16 で1067x800 -> 1072x800。動画のエンコーダなどで2や16の倍数が必要な場合に使います。")
+		preview           = flag.String("preview", "", "元の画像を出力と同じ大きさに縮小したものとリサイズ後の画像を並べた比較画像を、ファイルごとに\"名前_preview.png\"として書き出します。horizontal(横に並べる), vertical(縦に並べる)のいずれかを指定します。補間方法やシャープの設定の確認に使います。")
+		aspect            = flag.String("aspect", "", "画像の中から\"幅:高さ\"の縦横比の最も大きい範囲を切り抜きます。例: -aspect 16:9。width, heightなどのサイズを指定した場合は、切り抜いた後にそのサイズにリサイズします。指定しない場合は切り抜いた大きさのまま出力します。circle, montageとは同時に指定できません。")
+		gravity           = flag.String("gravity", resizer.GRAVITY_CENTER, "aspectで切り抜くときに残す位置をcenter, top, bottom, left, right, topleft, topright, bottomleft, bottomrightから指定します。")
+		checkpointFile    = flag.String("checkpoint", "", "処理が終わった入力ファイルを記録するファイルのパスです。既にある場合は、記録されているファイルを読み飛ばして続きから処理します。中断された大量のファイルの処理を再開する場合に使います。処理中にCtrl+C(SIGINT)を受け取った場合は、処理中のファイルを中断して終了します。inputArchive, montage, inspectとは同時に指定できません。")
+		noDateFallback    = flag.Bool("noMetadataDateFallback", false, "organizeByDateで、EXIFの撮影日時がない、または壊れている画像にファイルの更新日時を使わず、outputDir/unknown/に出力します。コピーなどで更新日時が変わっている場合に使います。")
+		srcset            = flag.String("srcset", "", "レスポンシブ画像(img要素のsrcset)用に、,区切りで指定した幅ごとの画像を高さを自動で計算して書き出します。例: -srcset 320,640,960,1280。ファイル名は\"名前_320w.jpg\"のようになります。元の画像より大きい幅は作りません。width, heightなどのサイズの指定は不要です。tile, replace, montage, inspectとは同時に指定できません。")
+		srcsetManifest    = flag.String("srcsetManifest", "", "srcsetで書き出した画像の一覧を書き出すファイルのパスです。拡張子が.htmlの場合はimg要素、それ以外はJSONで書き出します。省略した場合はoutputDir/srcset.jsonです。")
+		stripScale        = flag.Bool("stripScale", false, "縮小するときに、画像全体をRGBAに変換した複製と縮小の中間結果を作らずに、元の画像を上から少しずつ変換しながら縮小します。元の画像のデコードは帯ごとには行わず画像全体を一度に行うため、メモリの使用量の最大値はデコード結果の分だけ元の画像の大きさに応じて増えます。20000x2000のパノラマのような大きな画像を小さく縮小する場合に、中間の複製の分のメモリを減らせます。fastHugeとは同時に指定できません。")
+		dimSuffix         = flag.Bool("dimSuffix", false, "出力ファイル名のsuffixの後に、実際に出力した画像の幅・高さを\"-幅x高さ\"として付けます。例: photo-800x600.jpg。縦横比から計算した側やpow2の余白も反映したサイズになります。hashNameを指定した場合は使われません。")
+		verify            = flag.Bool("verifyOutput", false, "書き出した画像を読み込み直してデコードし、幅・高さが出力したサイズと一致するかを確かめます。確かめられなかったファイルはエラーとして表示します(ファイルは残ります)。読み込み直す分、処理に時間がかかります。")
+		exifThumb         = flag.Bool("exifThumbnail", false, "入力のEXIFにサムネイルがある場合、リサイズ後の画像から長辺160pxのサムネイルを作り直して出力のJPEGに入れます。指定しない場合、古いサムネイルは出力に残りません(EXIFはコピーされません)。")
+		orderedOutput     = flag.Bool("orderedOutput", false, "workersが2以上の場合も、ファイルごとのエラー・警告・progressの表示を入力の順番で行います。実行ごとのログを比べやすくなります。前のファイルの処理が終わるまで、後のファイルの表示は待たされます。")
+		checksum          = flag.String("checksum", "", "出力ファイルごとに、書き出した内容のハッシュを隣の\"出力ファイル名.sha256\"(md5の場合は\".md5\")に書き出します。sha256またはmd5で指定します。中身はsha256sum/md5sumと同じ形式で、\"sha256sum -c\"で確かめられます。")
+		maxOutputBytes    = flag.Int64("maxOutputBytes", 0, "出力ファイルをこのバイト数以下にします。まずJPEG/WebPの品質を40まで下げ、それでも収まらない場合は幅・高さを1回あたり0.9倍以下に、最大8回まで縮小し直します。収まらない場合はエラーになります。outFormat smallest, tile, pow2とは同時に指定できません。")
+		jsonlPath         = flag.String("jsonl", "", "ファイルごとの結果を、処理が終わるたびに1行1つのJSONとしてこのファイルに書き出します。失敗したファイルはerrorにエラーの内容が入ります。workersが2以上の場合は終わった順になります(orderedOutputを指定した場合は入力の順)。標準出力には他の表示も出るため、別のコマンドに渡す場合は -jsonl >(jq .) のように指定します。")
+		sampleEveryNth    = flag.Int("sampleEveryNth", 0, "入力ファイル(inputFiles, inputList, inputArchiveを展開し、重複を除いた後の順番)の1番目から数えて、Nファイルごとに1つだけを処理します。大量の画像を手早く確かめる場合に使います。inspect, montageにも適用され、checkpointで読み飛ばすファイルは間引いた後に除きます。")
+		frameStep         = flag.Int("frameStep", 0, "アニメーションPNGをN(2以上)フレームごとに1フレームだけ残してリサイズし、フレーム数を減らします。取り除いたフレームの表示時間は直前に残したフレームに足すため、全体の再生時間は変わりません。GIF, WebPのアニメーションのフレームは間引けないため、アニメーションPNG以外のファイルはエラーになります。outFormat jpeg, webp, smallest, tileとは同時に指定できません。")
+		encoderOpts       = flag.String("encoderOpts", "", "エンコーダの設定を\"キー=値\"のカンマ区切りで指定します。例: jpeg.quality=90,png.compression=best,webp.lossless=true。キーはjpeg.quality, jpeg.chromaSubsampling, webp.quality, webp.lossless, png.compression(default, none, speed, best)で、quality, webpLossless, chromaSubsamplingの指定より優先します。")
+		cacheFile         = flag.String("cacheFile", "", "変換した入力ファイルの大きさ・更新日時・内容のハッシュと出力ファイルを記録するファイルです。次回、同じ設定で実行したときに、変わっていない入力ファイルのうち出力が残っているものは読み込まずに読み飛ばします。更新日時だけが変わった場合は内容のハッシュで確かめます。壊れた行は無視します。sequence, hashManifest, srcset, deleteSource, montage, inspectとは同時に指定できません。")
+		pow2              = flag.Bool("pow2", false, "縮小後の画像の縦横比は変えずに、幅・高さがそれぞれ次の2のべき乗になるよう右と下に余白を付けます。例: 300x200 -> 512x256。余白はbackgroundの色、未指定の場合は透過になります。")
+		background        = flag.String("background", "", "余白を塗りつぶす色を#rrggbbまたは#rrggbbaaで指定します。未指定の場合は透過になります(透過を扱えないJPEGでは黒になります)。")
+		backgroundImage   = flag.String("backgroundImage", "", "縮小後の画像の下に敷く背景画像のファイルです。縮小後の画像(pow2の余白を含む)の大きさいっぱいに縦横比を保って拡大・縮小し、はみ出す部分は中央を残して切り取ります。透過のある商品画像などに使います。backgroundとは同時に指定できません。")
+		noUpscale         = flag.Bool("noUpscale", false, "元の画像より大きくなるサイズが指定された場合、拡大せず元の画像に収まるサイズにします。")
+		allowUpscale      = flag.Bool("allowUpscale", false, "元の画像より大きくなる場合に表示する警告を出さないようにします。")
+		tile              = flag.Int("tile", 0, "縮小後の画像を指定したサイズ四方のタイルに分割して出力します。ファイル名には行・列の番号が付きます。例: -tile 256 A01.jpg -> A01_r0_c0.jpg, A01_r0_c1.jpg, ...")
+		montage           = flag.String("montage", "", "すべての入力画像をwidth×heightのセルに縮小し、\"列x行\"の格子に並べた一覧画像(montage.png)を1枚作ります。例: -montage 4x3。画像がセルの数より多い場合は複数枚に分けます。")
+		montageLabels     = flag.Bool("montageLabels", false, "montageの各セルの下にファイル名を表示します。")
+		hashName          = flag.Bool("hashName", false, "出力ファイル名を、出力画像の内容のSHA-256ハッシュの先頭16文字にします。例: a1b2c3d4e5f60718.jpg。suffixは無視されます。")
+		hashManifest      = flag.String("hashManifest", "", "hashNameを指定した場合に、入力ファイルと出力ファイル名の対応をJSONで書き出すファイルのパスです。")
+		preserveStructure = flag.Bool("preserveStructure", false, "baseDirの下にある入力ファイルについて、baseDirからの相対的なディレクトリ構成をoutputDirの下に再現して出力します。例: -baseDir src -inputFiles a/b.jpg -> output/a/b.jpg")
+		replace           = flag.Bool("replace", false, "出力先を作らずに、入力ファイルをリサイズ後の画像で置き換えます(元の画像は残りません)。書き込みは一時ファイルに行い、完了してから置き換えます。入力と同じ形式で出力され、outFormat, suffix, circle, ico, tile, hashName, sequence, montage, inputArchive, organizeByDateとは同時に指定できません。")
+		allowInPlace      = flag.Bool("allowInPlace", false, "出力先が入力ファイルのいずれかと同じパスになる場合でも上書きを許可します。指定しない場合、そのファイルの出力は中止されます。")
+		sequence          = flag.String("sequence", "", "出力ファイル名を、指定した文字列に処理順の連番を付けた名前にします。例: -sequence frame_ -> frame_0001.jpg, frame_0002.jpg, ...。連番は出力に成功したファイルにだけ振られます。")
+		sequenceStart     = flag.Int("sequenceStart", 1, "sequenceの連番の開始番号です。")
+		sequencePad       = flag.Int("sequencePad", 4, "sequenceの連番をゼロ埋めする桁数です。")
+		autoOrient        = flag.Bool("autoOrient", false, "JPEGのEXIF、PNGのeXIfチャンクに記録された向き(Orientation)に合わせて、回転・反転してからリサイズします。")
+		organizeByDate    = flag.Bool("organizeByDate", false, "JPEG, PNGのEXIFの撮影日時をもとに、outputDir/年/月/に振り分けて出力します。撮影日時がない場合はファイルの更新日時を使います。例: output/2024/05/A01.jpg")
+		tmpDir            = flag.String("tmpDir", "", "書き込み中の一時ファイルを作成するディレクトリです。書き込みが終わると出力先に移動します。省略した場合は出力先と同じディレクトリを使います。出力先と別のファイルシステムを指定した場合は移動の代わりにコピーします。")
+		deleteSource      = flag.Bool("deleteSource", false, "出力ファイルの書き込みが完了したことを確認してから、入力ファイルを削除します。削除したファイルは元に戻せないため、confirmDeleteSourceも同時に指定する必要があります。replace, allowInPlace, inputArchive, montage, inspectとは同時に指定できません。")
+		confirmDelete     = flag.Bool("confirmDeleteSource", false, "deleteSourceで入力ファイルを削除することを了承します。")
+		mirrorPerms       = flag.Bool("mirrorPerms", false, "outputDirを作成するときに、入力ファイルのあるディレクトリと同じパーミッションにします。")
+		dither            = flag.Bool("dither", false, "減色時に誤差拡散(Floyd–Steinberg)を行い、グラデーションの縞を目立たなくします。パレット形式のPNGはPNGで出力する場合に元のパレットのまま、16bitの画像は8bitに落として出力されます。")
+		normalize         = flag.Bool("normalize", false, "縮小後の画像の明るさの範囲をチャンネルごとに0〜255へ引き伸ばし、コントラストを自動補正します。")
+		interpolation     = flag.String("interpolation", "", "縮小に使う補間方法をnearest, bilinear, catmullrom, lanczos2, lanczos3から指定します。lanczos3は多くの画像編集ソフトの既定と同じ半径3のLanczosで、Catmull-Romより細部が残りますが処理は遅くなります。省略した場合はcatmullromです。kernelとは同時に指定できません。")
+		kernel            = flag.String("kernel", "", "縮小に使うカーネルをlanczos, triangle, gaussianから指定します。省略した場合はCatmull-Romで縮小します。")
+		kernelRadius      = flag.Float64("kernelRadius", 0, "kernelの半径(入力画素単位)です。1〜8で指定します。大きいほどぼけにくく、処理は遅くなります。0の場合はlanczosが3, triangleが1, gaussianが2になります。")
+		fastHuge          = flag.Bool("fastHuge", false, "縮小後のサイズの4倍以上ある画像を、先に1/2ずつ高速に縮小してから仕上げの縮小を行います。大きな写真からサムネイルを作る場合に速くなります。")
+		colorModel        = flag.String("colorModel", "", "出力する画像のカラーモデルをrgb, rgba, grayから指定します。rgb, grayでは透過部分をbackgroundの色(未指定の場合は黒)で塗りつぶします。rgbaはjpegでは出力できません。PNGでは透過のない画像はrgbaを指定してもRGBで出力されます。")
+		comment           = flag.String("comment", "", "出力画像に埋め込むコメントです。例: -comment \"generated-by: pipeline v2\"。JPEGはCOMセグメント、PNGはtEXtチャンク(ASCII以外を含む場合はiTXtチャンク)に書き込みます。WebPには埋め込まれません。")
+		keepColorChunks   = flag.Bool("keepColorChunks", false, "PNGからPNGに出力する場合に、入力のgAMA, cHRM, sRGB, iCCP, cICP(HDR)チャンクを出力にコピーし、色の見え方を保ちます。グレースケールとカラーが入れ替わる場合、ICCプロファイル(iCCP)はコピーしません。")
+		square            = flag.Int("square", 0, "中央から短辺を一辺とする正方形を切り抜き、指定した大きさのN×Nにリサイズします。例: -square 128。circleと組み合わせると、円形に透過させたN×NのPNGになります。width, height, size, megapixels, scaleX, scaleY, matchSize, aspectとは同時に指定できません。")
+		circle            = flag.Bool("circle", false, "中央を正方形に切り抜き、円形に透過させたPNGを出力します。透過を扱えないJPEGでの出力には対応していないため、入力がJPEGでもoutFormatを省略した場合は拡張子.pngのPNGで出力されます。outFormat jpegとは同時に指定できません。")
+	)
+	flag.Parse()
+
+	// 引数チェック。必須はinputFiles, inputList, inputArchiveのいずれかと、height, widthのいずれか。
+	if *inputFiles == "" && *inputListFile == "" && *inputArchive == "" {
+		fmt.Println("inputFiles, inputList, inputArchiveのいずれかの指定は必須です。")
+		os.Exit(-1)
+	}
+	if *inputArchive != "" && (*inputFiles != "" || *inputListFile != "") {
+		fmt.Println("inputArchiveはinputFiles, inputListとは同時に指定できません。")
+		os.Exit(-1)
 	}
 
-	var imgSrc image.Image
-	mReader := io.MultiReader(imgHeader, src)
-	if t == TYPE_JPG {
-		imgSrc, err = jpeg.Decode(mReader)
-	} else {
-		imgSrc, err = png.Decode(mReader)
+	// sizeが指定されていればwidth, heightより優先する。
+	if *size != "" {
+		w, h, err := parseSize(*size)
+		if err != nil {
+			fmt.Printf("sizeの指定が不正です。: %s\n", err.Error())
+			os.Exit(-1)
+		}
+		*width, *height = w, h
 	}
-	if err != nil {
-		return err
+	if *matchSize != "" {
+		if *width != 0 || *height != 0 || *megapixels > 0 || *scaleX > 0 || *scaleY > 0 {
+			fmt.Println("matchSizeはwidth, height, size, megapixels, scaleX, scaleYと同時に指定できません。")
+			os.Exit(-1)
+		}
+		w, h, err := referenceSize(*matchSize)
+		if err != nil {
+			fmt.Printf("[ERROR] %s: %s\n", *matchSize, err.Error())
+			os.Exit(-1)
+		}
+		*width, *height = w, h
 	}
 
-	// rectange of image
-	rctSrc := imgSrc.Bounds()
-	var newW, newH int
-	if w > 0 && h > 0 {
-		newH = h
-		newW = w
-	} else if h > 0 {
-		newH = h
-		newW = rctSrc.Dx() * (newH * 100 / rctSrc.Dy()) / 100
-	} else if w > 0 {
-		newW = w
-		newH = rctSrc.Dy() * (newW * 100 / rctSrc.Dx()) / 100
+	if *square < 0 {
+		fmt.Println("squareは1以上の整数で指定してください。")
+		os.Exit(-1)
+	}
+	if *square > 0 {
+		if *width != 0 || *height != 0 || *megapixels > 0 || *scaleX > 0 || *scaleY > 0 || *aspect != "" {
+			fmt.Println("squareはwidth, height, size, megapixels, scaleX, scaleY, matchSize, aspectとは同時に指定できません。")
+			os.Exit(-1)
+		}
+		*width, *height = *square, *square
 	}
 
-	imgDst := image.NewRGBA(image.Rect(0, 0, newW, newH))
-	draw.CatmullRom.Scale(imgDst, imgDst.Bounds(), imgSrc, rctSrc, draw.Over, nil)
+	if *width < resizer.SIZE_AUTO || *height < resizer.SIZE_AUTO {
+		fmt.Println("width, heightは1以上の整数、または自動で計算する場合は-1で指定してください。")
+		os.Exit(-1)
+	}
+	if (*width == resizer.SIZE_AUTO && *height < 1) || (*height == resizer.SIZE_AUTO && *width < 1) {
+		fmt.Println("width, heightの一方に-1を指定した場合は、もう一方に1以上の整数を指定してください。両方を-1にはできません。")
+		os.Exit(-1)
+	}
+	if *scaleX < 0 || *scaleY < 0 || math.IsNaN(*scaleX) || math.IsNaN(*scaleY) {
+		fmt.Println("scaleX, scaleYは0より大きい値で指定してください。")
+		os.Exit(-1)
+	}
+	if *scaleX > 0 || *scaleY > 0 {
+		if *width > 0 || *height > 0 || *megapixels > 0 {
+			fmt.Println("scaleX, scaleYはwidth, height, size, megapixelsと同時に指定できません。")
+			os.Exit(-1)
+		}
+	} else if *megapixels > 0 {
+		if *width > 0 || *height > 0 {
+			fmt.Println("megapixelsはwidth, height, sizeと同時に指定できません。")
+			os.Exit(-1)
+		}
+	} else if *width < 1 && *height < 1 && !*ico && *aspect == "" && *srcset == "" {
+		fmt.Println("width, heightのいずれかは1以上の整数を指定する必要があります。")
+		os.Exit(-1)
+	}
 
-	if _, err := os.Stat(outputDir); err != nil {
-		// 出力用ディレクトリが存在しないため、作成する。
-		if dirErr := os.Mkdir(outputDir, os.ModeDir); dirErr != nil {
-			return dirErr
+	var aspectW, aspectH int
+	if *aspect != "" {
+		w, h, err := resizer.ParseAspect(*aspect)
+		if err != nil {
+			fmt.Printf("aspectの指定が不正です。: %s\n", err.Error())
+			os.Exit(-1)
 		}
+		if *circle || *montage != "" {
+			fmt.Println("aspectはcircle, montageとは同時に指定できません。")
+			os.Exit(-1)
+		}
+		aspectW, aspectH = w, h
+	}
+	if !resizer.IsGravity(*gravity) {
+		fmt.Println("gravityにはcenter, top, bottom, left, right, topleft, topright, bottomleft, bottomrightのいずれかを指定してください。")
+		os.Exit(-1)
 	}
 
-	_, fileName := filepath.Split(srcPath)
-	outFile := fileName
-	if suffix != "" {
-		outFile = fmt.Sprintf("%[1]s%[3]s.%[2]s", strings.Split(fileName, "."), suffix)
+	if *width > 0 && *height > 0 && *keepAspect && *montage == "" && *square == 0 {
+		fmt.Printf("[INFO] 縦横比を保って%dx%dに収まるサイズにリサイズします。指定サイズちょうどに変形させる場合は-keepAspectRatio=falseを指定してください。\n", *width, *height)
 	}
-	outPath := filepath.Join(outputDir, outFile)
 
-	if _, err := os.Stat(outPath); err == nil {
-		// 出力用ファイルが存在する場合消す。
-		if rmErr := os.Remove(outPath); rmErr != nil {
-			return rmErr
+	if _, ok := resizer.Extension(*outFormat); *outFormat != "" && *outFormat != resizer.FORMAT_SMALLEST && *outFormat != resizer.FORMAT_AUTO_SMART && !ok {
+		fmt.Println("outFormatにはjpeg, png, webp, smallest, auto-smartのいずれかを指定してください。")
+		os.Exit(-1)
+	}
+	if *autoFormatColors < 1 || *autoFormatFlat <= 0 || *autoFormatFlat > 1 {
+		fmt.Println("autoFormatColorsは1以上の整数、autoFormatFlatは0より大きく1以下の値で指定してください。")
+		os.Exit(-1)
+	}
+	if *preview != "" && *preview != resizer.PREVIEW_HORIZONTAL && *preview != resizer.PREVIEW_VERTICAL {
+		fmt.Println("previewにはhorizontal, verticalのいずれかを指定してください。")
+		os.Exit(-1)
+	}
+	if *dimSuffix && *replace {
+		fmt.Println("dimSuffixはreplaceとは同時に指定できません。")
+		os.Exit(-1)
+	}
+	if *stripScale && *fastHuge {
+		fmt.Println("stripScaleはfastHugeとは同時に指定できません。")
+		os.Exit(-1)
+	}
+	var srcsetWidths []int
+	if *srcset != "" {
+		widths, err := resizer.ParseSrcset(*srcset)
+		if err != nil {
+			fmt.Printf("srcsetの指定が不正です。: %s\n", err.Error())
+			os.Exit(-1)
+		}
+		srcsetWidths = widths
+		if *tile > 0 || *replace || *montage != "" || *inspect {
+			fmt.Println("srcsetはtile, replace, montage, inspectとは同時に指定できません。")
+			os.Exit(-1)
 		}
 	}
-	dst, err := os.Create(outPath)
+	if *noDateFallback && !*organizeByDate {
+		fmt.Println("noMetadataDateFallbackはorganizeByDateと同時に指定してください。")
+		os.Exit(-1)
+	}
+	if *checkpointFile != "" && (*inputArchive != "" || *montage != "" || *inspect) {
+		fmt.Println("checkpointはinputArchive, montage, inspectとは同時に指定できません。")
+		os.Exit(-1)
+	}
+	if *preview != "" && (*replace || *montage != "" || *inspect) {
+		fmt.Println("previewはreplace, montage, inspectとは同時に指定できません。")
+		os.Exit(-1)
+	}
+	if *roundTo < 0 {
+		fmt.Println("roundToは0以上の整数で指定してください。")
+		os.Exit(-1)
+	}
+	if *circle && *outFormat == resizer.TYPE_JPG {
+		fmt.Println("circleは透過が必要なため、outFormat jpegとは同時に指定できません。")
+		os.Exit(-1)
+	}
+	if *hashName && (*ico || *tile > 0) {
+		fmt.Println("hashNameはico, tileとは同時に指定できません。")
+		os.Exit(-1)
+	}
+	if *sequence != "" && *hashName {
+		fmt.Println("sequenceとhashNameは同時に指定できません。")
+		os.Exit(-1)
+	}
+	if *hashManifest != "" && !*hashName {
+		fmt.Println("hashManifestはhashNameと同時に指定してください。")
+		os.Exit(-1)
+	}
+	if *workers < 1 {
+		fmt.Println("workersは1以上の整数で指定してください。")
+		os.Exit(-1)
+	}
+	if *maxDecodes < 0 {
+		fmt.Println("maxConcurrentDecodesは0以上の整数で指定してください。")
+		os.Exit(-1)
+	}
+	if err := resizer.CheckColorModel(*colorModel, *outFormat); err != nil {
+		fmt.Printf("colorModelの指定が不正です。rgb, rgba, grayのいずれかを指定し、rgbaはoutFormat jpegとは同時に指定できません。: %s\n", err.Error())
+		os.Exit(-1)
+	}
+	if *sanitizeNames {
+		*suffix, *sequence = resizer.SanitizeNamePart(*suffix), resizer.SanitizeNamePart(*sequence)
+	}
+	if err := resizer.CheckNamePart(*suffix); err != nil {
+		fmt.Printf("suffixの指定が不正です。ファイル名に使えない文字は指定できません(Windowsで使えない文字は-sanitizeNamesで_に置き換えられます)。: %s\n", err.Error())
+		os.Exit(-1)
+	}
+	if err := resizer.CheckNamePart(*sequence); err != nil {
+		fmt.Printf("sequenceの指定が不正です。ファイル名に使えない文字は指定できません(Windowsで使えない文字は-sanitizeNamesで_に置き換えられます)。: %s\n", err.Error())
+		os.Exit(-1)
+	}
+	if fi, err := os.Stat(*outputDir); *outputDir != "" && err == nil && !fi.IsDir() {
+		fmt.Printf("outputDirの%sはディレクトリではなくファイルです。出力先のディレクトリを指定してください。\n", *outputDir)
+		os.Exit(-1)
+	}
+	if *outputDir == "" && !*replace {
+		if *suffix == "" && !*dimSuffix {
+			fmt.Println("outputDirを空にして入力ファイルと同じディレクトリに出力する場合は、suffixまたはdimSuffixを指定してください。")
+			os.Exit(-1)
+		}
+		if *preserveStructure || *inputArchive != "" {
+			fmt.Println("outputDirを空にした場合は、preserveStructure, inputArchiveは指定できません。")
+			os.Exit(-1)
+		}
+	}
+	if *replace && (*outFormat != "" || *suffix != "" || *circle || *ico || *tile > 0 || *hashName || *sequence != "" || *montage != "" || *inputArchive != "" || *organizeByDate) {
+		fmt.Println("replaceはoutFormat, suffix, circle, ico, tile, hashName, sequence, montage, inputArchive, organizeByDateとは同時に指定できません。")
+		os.Exit(-1)
+	}
+	if *deleteSource {
+		if !*confirmDelete {
+			fmt.Println("deleteSourceは入力ファイルを削除し元に戻せないため、confirmDeleteSourceも同時に指定してください。")
+			os.Exit(-1)
+		}
+		// 出力が入力と同じパスになり得る場合は、削除によって出力を失うおそれがあるため中止する。
+		if *replace || *allowInPlace || *inputArchive != "" || *montage != "" || *inspect {
+			fmt.Println("deleteSourceはreplace, allowInPlace, inputArchive, montage, inspectとは同時に指定できません。")
+			os.Exit(-1)
+		}
+	}
+	if *minBytes < 0 || *minWidth < 0 {
+		fmt.Println("onlyLargerThanBytes, onlyWiderThanは0以上の整数で指定してください。")
+		os.Exit(-1)
+	}
+	if *copySkipped && (*replace || *outputDir == "" || (*minBytes == 0 && *minWidth == 0)) {
+		fmt.Println("copySkippedはonlyLargerThanBytes, onlyWiderThanと同時に指定してください。replaceとは同時に指定できず、outputDirを空にした場合は使えません。")
+		os.Exit(-1)
+	}
+	if *copyUnsupported && (*skipUnsupported || *replace || *outputDir == "") {
+		fmt.Println("copyUnsupportedはskipUnsupported, replaceとは同時に指定できません。また、outputDirを空にした場合は使えません。")
+		os.Exit(-1)
+	}
+	if len(*comment) > resizer.MaxJPEGCommentSize {
+		fmt.Printf("commentは%dバイト以下で指定してください。\n", resizer.MaxJPEGCommentSize)
+		os.Exit(-1)
+	}
+	if *comment != "" && *outFormat == resizer.TYPE_WEBP {
+		fmt.Println("[WARN] WebPにはcommentを埋め込めないため、commentは無視されます。")
+	}
+	if *tile < 0 || (*tile > 0 && *outFormat == resizer.FORMAT_SMALLEST) {
+		fmt.Println("tileは1以上の整数で指定し、outFormat smallestとは同時に指定できません。")
+		os.Exit(-1)
+	}
+	if *cacheFile != "" && (*sequence != "" || *hashManifest != "" || *srcset != "" || *deleteSource || *montage != "" || *inspect) {
+		fmt.Println("cacheFileはsequence, hashManifest, srcset, deleteSource, montage, inspectとは同時に指定できません。")
+		os.Exit(-1)
+	}
+	if *frameStep < 0 {
+		fmt.Println("frameStepは1以上の整数で指定してください。")
+		os.Exit(-1)
+	}
+	if *frameStep > 1 && ((*outFormat != "" && *outFormat != resizer.TYPE_PNG && *outFormat != resizer.FORMAT_AUTO_SMART) || *tile > 0) {
+		fmt.Println("frameStepはアニメーションPNGのまま出力する場合にだけ使えるため、outFormat jpeg, webp, smallest, tileとは同時に指定できません。")
+		os.Exit(-1)
+	}
+	if *sampleEveryNth < 0 {
+		fmt.Println("sampleEveryNthは1以上の整数で指定してください。")
+		os.Exit(-1)
+	}
+	if *maxOutputBytes < 0 || (*maxOutputBytes > 0 && (*outFormat == resizer.FORMAT_SMALLEST || *tile > 0 || *pow2)) {
+		fmt.Println("maxOutputBytesは0以上の整数で指定し、outFormat smallest, tile, pow2とは同時に指定できません。")
+		os.Exit(-1)
+	}
+	if _, ok := checksumAlgorithms[*checksum]; *checksum != "" && !ok {
+		fmt.Printf("checksumは%sまたは%sで指定してください。\n", CHECKSUM_SHA256, CHECKSUM_MD5)
+		os.Exit(-1)
+	}
+	chromaSubsampling, err := resizer.ParseChromaSubsampling(*chroma)
 	if err != nil {
-		return err
+		fmt.Printf("chromaSubsamplingの指定が不正です。: %s\n", err.Error())
+		os.Exit(-1)
+	}
+	if !resizer.ChromaSubsamplingSupported && chromaSubsampling != resizer.DefaultChromaSubsampling {
+		fmt.Printf("[WARN] jpegliタグなしでビルドされているため、chromaSubsampling %sは使用できません。%sで出力します。\n", chromaSubsampling, resizer.DefaultChromaSubsampling)
+		chromaSubsampling = resizer.DefaultChromaSubsampling
 	}
-	defer dst.Close()
 
-	if t == TYPE_JPG {
-		if err := jpeg.Encode(dst, imgDst, &jpeg.Options{Quality: 100}); err != nil {
-			return err
-		}
-	} else if t == TYPE_PNG {
-		if err := png.Encode(dst, imgDst); err != nil {
-			return err
+	var qualityValue int
+	var formatQuality map[string]int
+	var ssimValue float64
+	if *quality == "auto" {
+		if *ssimTarget <= 0 || *ssimTarget > 1 {
+			fmt.Println("ssimは0より大きく1以下の値で指定してください。")
+			os.Exit(-1)
 		}
+		ssimValue = *ssimTarget
+	} else if qualityValue, formatQuality, err = resizer.ParseQuality(*quality); err != nil {
+		fmt.Printf("qualityは1〜100の整数、\"jpeg=85,webp=80\"のような形式ごとの指定、autoのいずれかで指定してください。: %s\n", err.Error())
+		os.Exit(-1)
 	}
 
-	return nil
-}
+	var bg color.Color
+	if *background != "" {
+		if bg, err = resizer.ParseHexColor(*background); err != nil {
+			fmt.Printf("backgroundの指定が不正です。: %s\n", err.Error())
+			os.Exit(-1)
+		}
+	}
 
-func main() {
-	// コマンドライン引数の設定
-	var (
-		outputDir  = flag.String("outputDir", "output", "リサイズ後の出力先を指定します。ない場合は作ります。")
-		width      = flag.Int("width", 0, "リサイズ後の画像サイズです。-1を指定した場合、高さから自動で計算されます。")
-		height     = flag.Int("height", 0, "リサイズ後の画像サイズです。-1を指定した場合、幅から自動で計算されます。")
-		inputFiles = flag.String("inputFiles", "", "画像変換するファイルです。,区切りで複数ファイルを指定できます。baseDirオプションを使用することで、相対位置を変更することができます。")
-		baseDir    = flag.String("baseDir", "", "入力ファイルの基準となるディレクトリ位置です。デフォルトは実行ファイルを実行した位置です。")
-		suffix     = flag.String("suffix", "", "変換後の画像名にsuffixで指定した文字列を付与します。例: -sufix _resized A01.jpg -> A01_resized.jpg")
-	)
-	flag.Parse()
+	var bgImage image.Image
+	if *backgroundImage != "" {
+		if *background != "" {
+			fmt.Println("backgroundImageとbackgroundは同時に指定できません。")
+			os.Exit(-1)
+		}
+		// 背景画像はバッチ全体で使い回すため、最初に一度だけ読み込む。
+		if bgImage, err = resizer.LoadBackgroundImage(*backgroundImage); err != nil {
+			fmt.Printf("[ERROR] %s: %s\n", *backgroundImage, err.Error())
+			os.Exit(-1)
+		}
+	}
 
-	// 引数チェック。必須はinputFilesとheight, widthのいずれか。
-	if *inputFiles == "" {
-		fmt.Println("inputFilesの指定は必須です。")
+	var scaler draw.Scaler
+	if *interpolation != "" && *kernel != "" {
+		fmt.Println("interpolationとkernelは同時に指定できません。")
 		os.Exit(-1)
 	}
-
-	if *width < 1 && *height < 1 {
-		fmt.Println("width, heightのいずれかは1以上の整数を指定する必要があります。")
+	if *interpolation != "" {
+		if scaler, err = resizer.NewInterpolation(*interpolation); err != nil {
+			fmt.Printf("interpolationの指定が不正です。: %s\n", err.Error())
+			os.Exit(-1)
+		}
+	}
+	if *kernel != "" {
+		if scaler, err = resizer.NewKernel(*kernel, *kernelRadius); err != nil {
+			fmt.Printf("kernel, kernelRadiusの指定が不正です。: %s\n", err.Error())
+			os.Exit(-1)
+		}
+	} else if *kernelRadius != 0 {
+		fmt.Println("kernelRadiusはkernelと同時に指定してください。")
 		os.Exit(-1)
 	}
 
-	fileList := strings.Split(*inputFiles, ",")
-	for i, v := range fileList {
+	var montageCols, montageRows int
+	if *montage != "" {
+		montageCols, montageRows, err = parseSize(*montage)
+		if err != nil || montageCols < 1 || montageRows < 1 {
+			fmt.Println("montageは\"列x行\"の形式で、列・行とも1以上の整数を指定してください。例: 4x3")
+			os.Exit(-1)
+		}
+		if *width < 1 || *height < 1 {
+			fmt.Println("montageを指定する場合は、セルのサイズとしてwidth, heightの両方を指定してください。")
+			os.Exit(-1)
+		}
+	}
+
+	opt := resizer.Options{
+		Width:             *width,
+		Height:            *height,
+		OutputDir:         *outputDir,
+		Suffix:            *suffix,
+		KeepAspectRatio:   *keepAspect,
+		StrictAspect:      *strictAspect,
+		Megapixels:        *megapixels,
+		ScaleX:            *scaleX,
+		ScaleY:            *scaleY,
+		OutFormat:         *outFormat,
+		Quality:           qualityValue,
+		FormatQuality:     formatQuality,
+		SSIM:              ssimValue,
+		WebPLossless:      *webpLossless,
+		ChromaSubsampling: chromaSubsampling,
+		Scaler:            scaler,
+		MaxPixels:         *maxPixels,
+		ICO:               *ico,
+		TrimTransparent:   *trimTransparent,
+		Pow2:              *pow2,
+		Background:        bg,
+		BackgroundImage:   bgImage,
+		NoUpscale:         *noUpscale,
+		AllowUpscale:      *allowUpscale,
+		Tile:              *tile,
+		HashName:          *hashName,
+		BaseDir:           *baseDir,
+		PreserveStructure: *preserveStructure,
+		AutoOrient:        *autoOrient,
+		OrganizeByDate:    *organizeByDate,
+		TmpDir:            *tmpDir,
+		Replace:           *replace,
+		MirrorPerms:       *mirrorPerms,
+		Dither:            *dither,
+		Square:            *square > 0,
+		Circle:            *circle,
+		Workers:           *workers,
+		FileTimeout:       *fileTimeout,
+		TotalTimeout:      *timeoutTotal,
+		FailFast:          *failFast,
+		SkipUnsupported:   *skipUnsupported,
+		CopySkipped:       *copySkipped,
+		CopyUnsupported:   *copyUnsupported,
+		Sequence:          *sequence,
+		SequenceStart:     *sequenceStart,
+		SequencePad:       *sequencePad,
+		FastHuge:          *fastHuge,
+		ColorModel:        *colorModel,
+		Comment:           *comment,
+		KeepColorChunks:   *keepColorChunks,
+		Normalize:         *normalize,
+	}
+
+	// 展開中の画像の数はワーカー数とは別に制限する。
+	opt.MaxConcurrentDecodes = *maxDecodes
+	opt.OnlyLargerThanBytes, opt.OnlyWiderThan = *minBytes, *minWidth
+	opt.AutoFormatMaxColors, opt.AutoFormatFlatRatio = *autoFormatColors, *autoFormatFlat
+	opt.RoundTo, opt.Preview = *roundTo, *preview
+	opt.AspectWidth, opt.AspectHeight, opt.Gravity = aspectW, aspectH, *gravity
+	opt.NoMetadataDateFallback, opt.Srcset = *noDateFallback, srcsetWidths
+	opt.StripScale, opt.DimSuffix, opt.VerifyOutput = *stripScale, *dimSuffix, *verify
+	opt.ExifThumbnail, opt.OrderedResults = *exifThumb, *orderedOutput
+	opt.MaxOutputBytes, opt.FrameStep = *maxOutputBytes, *frameStep
+	if *encoderOpts != "" {
+		if err := resizer.ApplyEncoderOpts(*encoderOpts, &opt); err != nil {
+			fmt.Printf("encoderOptsの指定が不正です。: %s\n", err.Error())
+			os.Exit(-1)
+		}
+		if !resizer.ChromaSubsamplingSupported && opt.ChromaSubsampling != resizer.DefaultChromaSubsampling {
+			fmt.Printf("[WARN] jpegliタグなしでビルドされているため、jpeg.chromaSubsampling %sは使用できません。%sで出力します。\n", opt.ChromaSubsampling, resizer.DefaultChromaSubsampling)
+			opt.ChromaSubsampling = resizer.DefaultChromaSubsampling
+		}
+	}
+
+	var inputList []string
+	if *inputFiles != "" {
+		inputList = strings.Split(*inputFiles, ",")
+	}
+	if *inputListFile != "" {
+		listed, err := readInputList(*inputListFile)
+		if err != nil {
+			fmt.Printf("inputListを読み込めませんでした。: %s\n", err.Error())
+			os.Exit(-1)
+		}
+		inputList = append(inputList, listed...)
+	}
+	fileList := make([]string, len(inputList))
+	for i, v := range inputList {
+		fileList[i] = v
 		// baseDirが設定されていても絶対パスで指定されていれば、baseDirの設定を適用しない。
 		if *baseDir != "" {
 			if !filepath.IsAbs(v) {
 				fileList[i] = filepath.Join(*baseDir, v)
 			}
 		}
+	}
+
+	// アーカイブの画像は一時ディレクトリに展開し、終了時に削除する。
+	// preserveStructureでアーカイブ内のディレクトリ構成を再現できるよう、展開先をbaseDirとする。
+	cleanupArchive := func() {}
+	if *inputArchive != "" {
+		archivePath := *inputArchive
+		if *baseDir != "" && !filepath.IsAbs(archivePath) {
+			archivePath = filepath.Join(*baseDir, archivePath)
+		}
+		archiveDir, err := os.MkdirTemp(*tmpDir, "image-resizer-")
+		if err != nil {
+			fmt.Printf("inputArchiveを展開する一時ディレクトリを作成できませんでした。: %s\n", err.Error())
+			os.Exit(-1)
+		}
+		cleanupArchive = func() { os.RemoveAll(archiveDir) }
+		entries, err := extractArchive(archivePath, archiveDir)
+		if err != nil {
+			fmt.Printf("inputArchiveを展開できませんでした。: %s\n", err.Error())
+			cleanupArchive()
+			os.Exit(-1)
+		}
+		opt.BaseDir = archiveDir
+		for _, e := range entries {
+			inputList = append(inputList, *inputArchive+":"+e.Name)
+			fileList = append(fileList, e.Path)
+		}
+	}
+	defer cleanupArchive()
+
+	inputList, fileList = dedupeInputs(inputList, fileList)
+
+	// 前回の出力を入力にした場合などに元の画像を上書きしないよう、入力ファイルを保護する。
+	// 間引いたファイルも保護するため、間引く前に行う。
+	if !*allowInPlace && !*replace {
+		opt.ProtectedPaths = make(map[string]bool, len(fileList))
+		for _, p := range fileList {
+			if abs, err := filepath.Abs(p); err == nil {
+				opt.ProtectedPaths[abs] = true
+			}
+		}
+	}
+	if *sampleEveryNth > 1 {
+		inputList, fileList = sampleInputs(inputList, fileList, *sampleEveryNth)
+	}
+
+	stopProfiling, err := startProfiling(*cpuProfile, *memProfile)
+	if err != nil {
+		fmt.Printf("プロファイルを開始できませんでした。: %s\n", err.Error())
+		cleanupArchive()
+		os.Exit(-1)
+	}
+	defer stopProfiling()
+
+	// inspectは何も書き出さず、情報の表示だけを行う。
+	if *inspect {
+		for i, v := range inputList {
+			in, err := resizer.InspectImage(fileList[i], opt)
+			if err != nil {
+				fmt.Printf("[ERROR] %s: %s\n", v, err.Error())
+				continue
+			}
+			fmt.Printf("%s: %s\n", v, in)
+		}
+		return
+	}
+
+	// montageはファイルごとに出力せず、すべての画像をまとめた一覧画像を作る。
+	if *montage != "" {
+		outPaths, fileErrs, err := resizer.WriteMontage(fileList, montageCols, montageRows, *montageLabels, opt)
+		for _, fileErr := range fileErrs {
+			fmt.Printf("[ERROR] %s\n", fileErr.Error())
+		}
+		if err != nil {
+			fmt.Printf("[ERROR] montage: %s\n", err.Error())
+			stopProfiling()
+			cleanupArchive()
+			os.Exit(-1)
+		}
+		for _, p := range outPaths {
+			fmt.Printf("montage: %s\n", p)
+		}
+		return
+	}
+
+	// 前回までに処理を終えたファイルは読み飛ばす。
+	var done *checkpoint
+	if *checkpointFile != "" {
+		if done, err = openCheckpoint(*checkpointFile); err != nil {
+			fmt.Printf("checkpointを開けませんでした。: %s\n", err.Error())
+			stopProfiling()
+			os.Exit(-1)
+		}
+		defer done.Close()
+		var inputs, files []string
+		for i, p := range fileList {
+			if !done.has(p) {
+				inputs, files = append(inputs, inputList[i]), append(files, p)
+			}
+		}
+		if n := len(fileList) - len(files); n > 0 {
+			fmt.Printf("[INFO] checkpointに記録されている%dファイルを読み飛ばします。\n", n)
+		}
+		inputList, fileList = inputs, files
+	}
+
+	// 前回と同じ設定で変換済みで、入力が変わっておらず出力も残っているファイルは、読み込まずに読み飛ばす。
+	var cache *resultCache
+	cacheKey := func(i int) string {
+		if *inputArchive != "" {
+			return checkpointKey(inputList[i])
+		}
+		return checkpointKey(fileList[i])
+	}
+	if *cacheFile != "" {
+		if cache, err = openResultCache(*cacheFile, cacheSettings()); err != nil {
+			fmt.Printf("cacheFileを開けませんでした。: %s\n", err.Error())
+			stopProfiling()
+			cleanupArchive()
+			os.Exit(-1)
+		}
+		defer cache.Close()
+		var inputs, files []string
+		for i, p := range fileList {
+			if !cache.fresh(cacheKey(i), p) {
+				inputs, files = append(inputs, inputList[i]), append(files, p)
+			}
+		}
+		if n := len(fileList) - len(files); n > 0 {
+			fmt.Printf("[INFO] cacheFileで前回から変わっていない%dファイルを読み飛ばします。\n", n)
+		}
+		inputList, fileList = inputs, files
+	}
+
+	// 結果を1ファイルごとに1行のJSONとして、終わった順に書き出す。
+	var jsonl *os.File
+	if *jsonlPath != "" {
+		if jsonl, err = os.Create(*jsonlPath); err != nil {
+			fmt.Printf("jsonlを作成できませんでした。: %s\n", err.Error())
+			stopProfiling()
+			cleanupArchive()
+			os.Exit(-1)
+		}
+		defer jsonl.Close()
+	}
+
+	manifest := map[string]string{}
+	variants := make([][]resizer.SrcsetVariant, len(inputList))
+	batch := newBatchStats()
+	opt.OnResult = func(i int, r resizer.Result) {
+		v := inputList[i]
+		// 読み飛ばしたファイルも処理済みとし、失敗したファイルだけを次回もう一度処理する。
+		if done != nil && (r.Err == nil || errors.Is(r.Err, resizer.ErrBelowThreshold) || (*skipUnsupported && errors.Is(r.Err, resizer.ErrUnsupportedFormat))) {
+			if err := done.record(r.SourcePath); err != nil {
+				fmt.Printf("[WARN] %s: checkpointに記録できませんでした。: %s\n", v, err.Error())
+			}
+		}
+		if jsonl != nil {
+			if err := writeJSONLine(jsonl, r); err != nil {
+				fmt.Printf("[WARN] %s: jsonlに書き込めませんでした。: %s\n", v, err.Error())
+			}
+		}
+		if *skipUnsupported && errors.Is(r.Err, resizer.ErrUnsupportedFormat) {
+			batch.skipped++
+			return
+		}
+		if errors.Is(r.Err, resizer.ErrBelowThreshold) {
+			batch.small++
+			return
+		}
+		if r.Err != nil {
+			batch.add(nil, r.Err)
+			fmt.Printf("[ERROR] %s: %s\n", v, r.Err.Error())
+			return
+		}
+		batch.add(&r, nil)
+		for _, warning := range r.Warnings {
+			fmt.Printf("[WARN] %s: %s\n", v, warning)
+		}
+		if cache != nil {
+			if err := cache.record(cacheKey(i), &r); err != nil {
+				fmt.Printf("[WARN] %s: cacheFileに記録できませんでした。: %s\n", v, err.Error())
+			}
+		}
+
+		// サイドカーの書き込みに失敗しても画像自体は出力できているため、警告のみとする。
+		if *writeSidecar {
+			if err := resizer.WriteSidecarJSON(&r); err != nil {
+				fmt.Printf("[WARN] %s: サイドカーを書き込めませんでした。: %s\n", v, err.Error())
+			}
+		}
+		if *checksum != "" {
+			for _, p := range r.OutputPaths() {
+				if err := writeChecksum(p, *checksum); err != nil {
+					fmt.Printf("[WARN] %s: checksumを書き込めませんでした。: %s\n", v, err.Error())
+				}
+			}
+		}
+		if *hashManifest != "" {
+			manifest[v] = filepath.Base(r.OutputPath)
+		}
+		if *srcset != "" {
+			variants[i] = r.Variants
+		}
+		if *deleteSource {
+			if err := removeSource(&r); err != nil {
+				fmt.Printf("[WARN] %s: 入力ファイルを削除しませんでした。: %s\n", v, err.Error())
+			}
+		}
+	}
+	if *progress {
+		opt.OnProgress = func(done, total int, current string) {
+			fmt.Printf("[%d/%d] %s\n", done, total, current)
+		}
+	}
+	// checkpointで続きから再開できる場合と、プロファイルを書き出す場合は、Ctrl+Cで処理中のファイルを中断し、
+	// checkpointやプロファイルを書き終えてから終了する。2回目のCtrl+Cではすぐに終了する。
+	ctx := context.Background()
+	if done != nil || *cpuProfile != "" || *memProfile != "" {
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, os.Interrupt)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			stop()
+		}()
+	}
+	results := resizer.BatchResizeContext(ctx, fileList, opt)
 
-		if err := ResizeImage(fileList[i], *width, *height, *outputDir, *suffix); err != nil {
-			fmt.Printf("[ERROR] %s: %s\n", v, err.Error())
+	skipped, timedOut, interrupted := 0, false, false
+	for _, r := range results {
+		if errors.Is(r.Err, resizer.ErrSkipped) {
+			skipped++
+			timedOut = timedOut || errors.Is(r.Err, context.DeadlineExceeded)
+			interrupted = interrupted || errors.Is(r.Err, context.Canceled)
+		}
+	}
+	if interrupted && ctx.Err() != nil {
+		if done != nil {
+			fmt.Printf("中断したため、残り%dファイルの処理を中止しました。同じcheckpointを指定して実行すると続きから処理します。\n", skipped)
+			done.Close()
+		} else {
+			fmt.Printf("中断したため、残り%dファイルの処理を中止しました。\n", skipped)
+		}
+		stopProfiling()
+		cleanupArchive()
+		os.Exit(130)
+	}
+	if timedOut {
+		fmt.Printf("timeoutTotal(%s)を過ぎたため、残り%dファイルの処理を中止しました。処理が終わったファイルは%dファイル(成功 %d, 失敗 %d)です。\n", *timeoutTotal, skipped, batch.succeeded+batch.failed, batch.succeeded, batch.failed)
+		stopProfiling()
+		cleanupArchive()
+		os.Exit(-1)
+	}
+	if *failFast && batch.failed > 0 {
+		fmt.Printf("failFastが指定されているため、残り%dファイルの処理を中止しました。\n", skipped)
+		stopProfiling()
+		cleanupArchive()
+		os.Exit(-1)
+	}
+
+	if *showStats {
+		batch.print(os.Stdout)
+	}
+
+	if *hashManifest != "" {
+		if err := writeHashManifest(*hashManifest, manifest); err != nil {
+			fmt.Printf("[ERROR] hashManifest: %s\n", err.Error())
+			stopProfiling()
+			cleanupArchive()
+			os.Exit(-1)
+		}
+	}
+	if *srcset != "" {
+		path := *srcsetManifest
+		if path == "" {
+			path = filepath.Join(*outputDir, "srcset.json")
+		}
+		if err := writeSrcsetManifest(path, inputList, variants); err != nil {
+			fmt.Printf("[ERROR] srcsetManifest: %s\n", err.Error())
+			stopProfiling()
+			cleanupArchive()
+			os.Exit(-1)
 		}
 	}
 }
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// runMainEnv が設定されている場合、テストバイナリはテストの代わりに渡された引数でmainを実行します。
+const runMainEnv = "IMAGE_RESIZER_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runMain はargsを引数にしてmainを別プロセスで実行し、その出力を返します。
+func runMain(t *testing.T, args ...string) string {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("main %v: %v\n%s", args, err, out)
+	}
+	return string(out)
+}
+
+func TestSquareCircle(t *testing.T) {
+	dir := t.TempDir()
+	src := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 300; x++ {
+			src.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	f, err := os.Create(filepath.Join(dir, "a.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, src); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(dir, "out")
+	runMain(t, "-square", "128", "-circle", "-baseDir", dir, "-inputFiles", "a.png", "-outputDir", out)
+
+	f, err = os.Open(filepath.Join(out, "a.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	switch img.(type) {
+	case *image.NRGBA, *image.RGBA:
+	default:
+		t.Fatalf("output is %T, want *image.NRGBA or *image.RGBA", img)
+	}
+	if img.Bounds() != image.Rect(0, 0, 128, 128) {
+		t.Fatalf("output is %v, want 128x128", img.Bounds())
+	}
+	for _, p := range []image.Point{{0, 0}, {127, 0}, {0, 127}, {127, 127}} {
+		if _, _, _, a := img.At(p.X, p.Y).RGBA(); a != 0 {
+			t.Errorf("corner %v has alpha %d, want 0", p, a)
+		}
+	}
+	if _, _, _, a := img.At(64, 64).RGBA(); a != 0xffff {
+		t.Errorf("center has alpha %d, want opaque", a)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chikin14niwa/image-resizer/resizer"
+)
+
+// writeHashManifest は入力ファイルから出力ファイル名への対応をJSONでpathに書き出します。
+func writeHashManifest(path string, manifest map[string]string) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// srcsetEntry はsrcsetのマニフェストに書き出す1つの入力ファイル分の情報です。
+type srcsetEntry struct {
+	Input    string                  `json:"input"`
+	Srcset   string                  `json:"srcset"`
+	Variants []resizer.SrcsetVariant `json:"variants"`
+}
+
+// writeSrcsetManifest は入力ファイルごとの画像の一覧を、pathの拡張子が.htmlの場合はimg要素、それ以外はJSONで書き出します。
+// 画像のパスは、そのまま使えるようpathのディレクトリからの相対パスにします。
+func writeSrcsetManifest(path string, inputs []string, variants [][]resizer.SrcsetVariant) error {
+	dir := filepath.Dir(path)
+	var entries []srcsetEntry
+	for i, vs := range variants {
+		if len(vs) == 0 {
+			continue
+		}
+		e := srcsetEntry{Input: inputs[i]}
+		var items []string
+		for _, v := range vs {
+			if rel, err := filepath.Rel(dir, v.Path); err == nil {
+				v.Path = rel
+			}
+			v.Path = filepath.ToSlash(v.Path)
+			e.Variants = append(e.Variants, v)
+			items = append(items, fmt.Sprintf("%s %dw", v.Path, v.Width))
+		}
+		e.Srcset = strings.Join(items, ", ")
+		entries = append(entries, e)
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".html") {
+		var b strings.Builder
+		for _, e := range entries {
+			// 最も大きい画像をsrcにして、srcsetに対応していないブラウザでも表示できるようにする。
+			largest := e.Variants[len(e.Variants)-1]
+			fmt.Fprintf(&b, "<img src=\"%s\" srcset=\"%s\" sizes=\"100vw\" width=\"%d\" height=\"%d\" alt=\"\">\n",
+				html.EscapeString(largest.Path), html.EscapeString(e.Srcset), largest.Width, largest.Height)
+		}
+		return os.WriteFile(path, []byte(b.String()), 0644)
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+)
+
+// startProfiling はcpuPathが指定されていればCPUプロファイルの記録を始めます。
+// 返り値の関数を呼ぶとCPUプロファイルを停止し、memPathが指定されていればその時点のヒーププロファイルを書き出します。
+// 2回目以降の呼び出しは何もしません。Ctrl+Cで中断した場合も、mainがcheckpointなどを書き終えてから呼び出します。
+func startProfiling(cpuPath, memPath string) (func(), error) {
+	var cpuFile *os.File
+	if cpuPath != "" {
+		f, err := os.Create(cpuPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+		cpuFile = f
+	}
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			if cpuFile != nil {
+				pprof.StopCPUProfile()
+				cpuFile.Close()
+			}
+			if memPath != "" {
+				if err := writeHeapProfile(memPath); err != nil {
+					fmt.Printf("[ERROR] memprofile: %s\n", err.Error())
+				}
+			}
+		})
+	}
+	return stop, nil
+}
+
+// writeHeapProfile はGCを実行した後のヒーププロファイルをpathに書き出します。
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	runtime.GC()
+	return pprof.WriteHeapProfile(f)
+}
@@ -0,0 +1,542 @@
+package resizer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"math"
+	"os"
+
+	"golang.org/x/image/draw"
+)
+
+// APNGのfcTLチャンクのdispose_op, blend_opの値です。
+const (
+	apngDisposeNone       = 0
+	apngDisposeBackground = 1
+	apngDisposePrevious   = 2
+	apngBlendSource       = 0
+	apngBlendOver         = 1
+)
+
+// apngFrame はAPNGの1フレームの情報です。画素はdecodeAPNGがフレームごとに呼び出す関数に渡します。
+type apngFrame struct {
+	// DelayNum, DelayDen はフレームの表示時間(DelayNum/DelayDen秒)です。
+	DelayNum, DelayDen uint16
+}
+
+// apngAnimation はAPNGのすべてのフレームと繰り返し回数です。
+type apngAnimation struct {
+	Frames []apngFrame
+	// Plays は繰り返し回数です。0の場合は無限に繰り返します。
+	Plays uint32
+}
+
+// pngChunk はPNGの1チャンクです。
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+// readPNGChunk はrから次のチャンクを読み込みます。CRCは確認しません。
+func readPNGChunk(r io.Reader) (pngChunk, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return pngChunk{}, err
+	}
+	// 長さを信用して先に確保すると、壊れたファイルで巨大な領域を確保してしまうため、実際に読めた分だけを使う。
+	size := int64(binary.BigEndian.Uint32(header[:4]))
+	data, err := io.ReadAll(io.LimitReader(r, size))
+	if err != nil {
+		return pngChunk{}, err
+	}
+	if int64(len(data)) != size {
+		return pngChunk{}, io.ErrUnexpectedEOF
+	}
+	var crc [4]byte
+	if _, err := io.ReadFull(r, crc[:]); err != nil {
+		return pngChunk{}, err
+	}
+	return pngChunk{typ: string(header[4:]), data: data}, nil
+}
+
+// writePNGChunk はtypのチャンクをCRCを付けてwに書き出します。
+func writePNGChunk(w io.Writer, typ string, data []byte) error {
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(len(data)))
+	copy(header[4:], typ)
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.BigEndian, crc.Sum32())
+}
+
+// resizeAPNG はアニメーションPNGのsrcPathのすべてのフレームをnewW×newHにリサイズし、表示時間を保ったままAPNGで出力します。
+// rctSrcは各フレームのうちリサイズに使う範囲です。
+func resizeAPNG(ctx context.Context, srcPath string, cfg image.Config, rctSrc image.Rectangle, newW, newH int, warnings []string, opt Options) (*Result, error) {
+	f, err := os.Open(srcPath)
+	if err != nil {
+		return nil, err
+	}
+	if opt.Dither {
+		warnings = append(warnings, "dither is not applied to animated PNG")
+	}
+
+	// 合成したフレームは画像全体の大きさのため、すべてを保持せずに合成するたびにリサイズし、リサイズ後の画像だけを残す。
+	orientation := exifOrientation(srcPath, TYPE_PNG, opt)
+	var (
+		frames []image.Image
+		bg     draw.RGBA64Image
+	)
+	anim, err := decodeAPNG(&ctxReader{ctx: ctx, r: f}, opt.MaxPixels, func(i int, canvas *image.RGBA) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// FrameStepで取り除くフレームはリサイズしない。
+		if opt.FrameStep > 1 && i%opt.FrameStep != 0 {
+			return nil
+		}
+		dst := newCanvas(canvas, image.Rect(0, 0, newW, newH))
+		scalerFor(opt).Scale(dst, dst.Bounds(), applyOrientation(canvas, orientation), rctSrc, draw.Over, nil)
+		finishImage(dst, opt)
+		if opt.Pow2 {
+			dst = padToPow2(dst, opt.Background)
+		}
+		if opt.BackgroundImage != nil {
+			// すべてのフレームは同じ大きさのため、背景画像の拡大・縮小は最初のフレームで一度だけ行う。
+			if bg == nil {
+				bg = fitBackground(opt.BackgroundImage, dst.Bounds(), opt)
+			}
+			dst = overBackground(dst, bg)
+		}
+		frames = append(frames, convertColorModel(dst, opt.ColorModel, opt.Background))
+		return nil
+	})
+	f.Close()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecode, err)
+	}
+	if opt.FrameStep > 1 {
+		anim = keepEveryNthFrame(anim, opt.FrameStep)
+	}
+
+	var buf bytes.Buffer
+	if err := encodeAPNG(&buf, frames, anim); err != nil {
+		return nil, err
+	}
+	data := buf.Bytes()
+	if opt.colorInfo != nil {
+		if data, err = addColorChunks(data, opt.colorInfo); err != nil {
+			return nil, err
+		}
+	}
+	if opt.Comment != "" {
+		if data, err = addComment(data, TYPE_PNG, opt.Comment); err != nil {
+			return nil, err
+		}
+	}
+
+	var out OutputWriter
+	if opt.Replace {
+		out, err = replaceOutput(ctx, srcPath, opt)
+	} else if opt.HashName {
+		out, err = createOutput(ctx, srcPath, contentHashName(data)+extensions[TYPE_PNG], opt)
+	} else {
+		out, err = createOutput(ctx, srcPath, outName(srcPath, opt.Suffix, extensions[TYPE_PNG], opt), opt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+	if _, err := out.Write(data); err != nil {
+		return nil, err
+	}
+	if err := out.Commit(); err != nil {
+		return nil, err
+	}
+
+	b := frames[0].Bounds()
+	if opt.VerifyOutput && opt.NewOutput == nil {
+		if err := verifyOutput(out.Name(), b.Dx(), b.Dy()); err != nil {
+			return nil, err
+		}
+	}
+	result := newResult(srcPath, out.Name(), cfg, b.Dx(), b.Dy(), TYPE_PNG, opt)
+	result.Frames = len(frames)
+	result.Warnings = warnings
+	return result, nil
+}
+
+// keepEveryNthFrame はanimの最初のフレームから数えてstepフレームごとに1フレームだけを残したアニメーションを返します。
+// 取り除いたフレームの表示時間は直前に残したフレームに足すため、全体の再生時間は変わりません。
+// フレームはそれまでのフレームと合成済みのため、取り除いても残したフレームの見た目は変わりません。
+// 画素はdecodeAPNGの時点で同じフレームだけをリサイズしておきます。
+func keepEveryNthFrame(anim *apngAnimation, step int) *apngAnimation {
+	kept := &apngAnimation{Plays: anim.Plays}
+	for i, frame := range anim.Frames {
+		if i%step == 0 {
+			kept.Frames = append(kept.Frames, frame)
+			continue
+		}
+		last := &kept.Frames[len(kept.Frames)-1]
+		last.DelayNum, last.DelayDen = addDelay(last.DelayNum, last.DelayDen, frame.DelayNum, frame.DelayDen)
+	}
+	return kept
+}
+
+// addDelay はfcTLの表示時間aNum/aDenとbNum/bDenを足した表示時間を返します。分母の0は100として扱います。
+// 分母の最小公倍数で正確に表せない場合は、uint16に収まる最も細かい単位(1/1000秒から)に丸めます。
+func addDelay(aNum, aDen, bNum, bDen uint16) (uint16, uint16) {
+	if aDen == 0 {
+		aDen = 100
+	}
+	if bDen == 0 {
+		bDen = 100
+	}
+	g, y := uint64(aDen), uint64(bDen)
+	for y != 0 {
+		g, y = y, g%y
+	}
+	den := uint64(aDen) / g * uint64(bDen)
+	num := uint64(aNum)*(den/uint64(aDen)) + uint64(bNum)*(den/uint64(bDen))
+	if den <= 0xffff && num <= 0xffff {
+		return uint16(num), uint16(den)
+	}
+	seconds := float64(aNum)/float64(aDen) + float64(bNum)/float64(bDen)
+	for _, d := range []float64{1000, 100, 10, 1} {
+		if n := math.Round(seconds * d); n <= 0xffff {
+			return uint16(n), uint16(d)
+		}
+	}
+	return 0xffff, 1
+}
+
+// keepsAnimation はoptでアニメーションPNGを入力した場合に、アニメーションのまま出力するかどうかを返します。
+// PNG以外の形式やタイル分割では、最初のフレーム(既定の画像)だけを静止画として出力します。
+func keepsAnimation(opt Options) bool {
+	return (opt.OutFormat == "" || opt.OutFormat == TYPE_PNG || opt.OutFormat == FORMAT_AUTO_SMART) && opt.Tile == 0
+}
+
+// isAPNG はpathのPNGファイルがアニメーションPNGかどうか(最初のIDATより前にacTLチャンクがあるか)を返します。
+func isAPNG(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	var sig [8]byte
+	if _, err := io.ReadFull(br, sig[:]); err != nil || string(sig[:]) != pngSignature {
+		return false
+	}
+	for {
+		c, err := readPNGChunk(br)
+		if err != nil {
+			return false
+		}
+		switch c.typ {
+		case "acTL":
+			return true
+		case "IDAT", "IEND":
+			return false
+		}
+	}
+}
+
+// decodeAPNG はrのAPNGを読み込み、dispose_op, blend_opに従ってフレームを合成するたびに、
+// i番目のフレームとして合成した画像全体をonFrameに渡します。canvasはonFrameから戻ると次のフレームの合成に使われます。
+// onFrameがエラーを返した場合は読み込みを中止してそのエラーを返します。返すアニメーションにはフレームの表示時間だけが入ります。
+// fcTLより前にあるIDATの画像(アニメーションに含まれない既定の画像)は使いません。
+// 画像全体の画素数がmaxPixels(0以下の場合は制限なし)を超える場合と、フレームが画像全体の範囲からはみ出す場合は、
+// フレームを展開する前にエラーにします。
+func decodeAPNG(r io.Reader, maxPixels int64, onFrame func(i int, canvas *image.RGBA) error) (*apngAnimation, error) {
+	br := bufio.NewReader(r)
+	var sig [8]byte
+	if _, err := io.ReadFull(br, sig[:]); err != nil {
+		return nil, err
+	}
+	if string(sig[:]) != pngSignature {
+		return nil, errors.New("not a png")
+	}
+
+	// fcTLとそのフレームの画像データ(IDATまたはfdATのシーケンス番号を除いた部分)です。
+	type rawFrame struct {
+		fctl []byte
+		data []byte
+	}
+	var (
+		ihdr   []byte
+		shared []pngChunk
+		anim   = &apngAnimation{}
+		frames []*rawFrame
+		cur    *rawFrame
+	)
+	for {
+		c, err := readPNGChunk(br)
+		if err != nil {
+			return nil, err
+		}
+		if c.typ == "IEND" {
+			break
+		}
+		switch c.typ {
+		case "IHDR":
+			ihdr = c.data
+		case "PLTE", "tRNS":
+			// フレームのデコードに必要な、全フレーム共通のチャンクです。
+			shared = append(shared, c)
+		case "acTL":
+			if len(c.data) < 8 {
+				return nil, errors.New("invalid acTL chunk")
+			}
+			anim.Plays = binary.BigEndian.Uint32(c.data[4:])
+		case "fcTL":
+			if len(c.data) < 26 {
+				return nil, errors.New("invalid fcTL chunk")
+			}
+			cur = &rawFrame{fctl: c.data}
+			frames = append(frames, cur)
+		case "IDAT":
+			if cur != nil {
+				cur.data = append(cur.data, c.data...)
+			}
+		case "fdAT":
+			if cur == nil || len(c.data) < 4 {
+				return nil, errors.New("invalid fdAT chunk")
+			}
+			cur.data = append(cur.data, c.data[4:]...)
+		}
+	}
+	if len(ihdr) < 13 {
+		return nil, errors.New("missing IHDR chunk")
+	}
+	if len(frames) == 0 {
+		return nil, errors.New("apng has no frames")
+	}
+
+	width, height := int64(binary.BigEndian.Uint32(ihdr)), int64(binary.BigEndian.Uint32(ihdr[4:]))
+	if maxPixels > 0 && width*height > maxPixels {
+		return nil, fmt.Errorf("%w: %dx%d exceeds %d pixels", ErrTooLarge, width, height, maxPixels)
+	}
+	canvas := image.NewRGBA(image.Rect(0, 0, int(width), int(height)))
+	for i, raw := range frames {
+		fw, fh := binary.BigEndian.Uint32(raw.fctl[4:]), binary.BigEndian.Uint32(raw.fctl[8:])
+		fx, fy := binary.BigEndian.Uint32(raw.fctl[12:]), binary.BigEndian.Uint32(raw.fctl[16:])
+		dispose, blend := raw.fctl[24], raw.fctl[25]
+
+		// fcTLの幅・高さのままデコードすると巨大な領域を確保してしまうため、画像全体に収まることを先に確かめる。
+		// 画像全体はmaxPixels以下のため、フレームの画素数もmaxPixels以下になる。
+		if fw == 0 || fh == 0 || int64(fx)+int64(fw) > width || int64(fy)+int64(fh) > height {
+			return nil, fmt.Errorf("frame %d (%dx%d at %d,%d) is outside the %dx%d canvas", i, fw, fh, fx, fy, width, height)
+		}
+		rect := image.Rect(int(fx), int(fy), int(fx)+int(fw), int(fy)+int(fh))
+
+		// フレームの部分だけを1枚のPNGとして組み立ててデコードする。
+		var buf bytes.Buffer
+		buf.WriteString(pngSignature)
+		frameIHDR := append([]byte{}, ihdr...)
+		binary.BigEndian.PutUint32(frameIHDR, fw)
+		binary.BigEndian.PutUint32(frameIHDR[4:], fh)
+		writePNGChunk(&buf, "IHDR", frameIHDR)
+		for _, c := range shared {
+			writePNGChunk(&buf, c.typ, c.data)
+		}
+		writePNGChunk(&buf, "IDAT", raw.data)
+		writePNGChunk(&buf, "IEND", nil)
+		img, err := png.Decode(&buf)
+		if err != nil {
+			return nil, fmt.Errorf("frame %d: %w", i, err)
+		}
+
+		// 最初のフレームのAPNG_DISPOSE_OP_PREVIOUSはBACKGROUNDとして扱う。
+		if i == 0 && dispose == apngDisposePrevious {
+			dispose = apngDisposeBackground
+		}
+		var previous *image.RGBA
+		if dispose == apngDisposePrevious {
+			previous = image.NewRGBA(rect)
+			draw.Draw(previous, rect, canvas, rect.Min, draw.Src)
+		}
+
+		op := draw.Over
+		if blend == apngBlendSource {
+			op = draw.Src
+		}
+		draw.Draw(canvas, rect, img, img.Bounds().Min, op)
+
+		if err := onFrame(i, canvas); err != nil {
+			return nil, err
+		}
+		anim.Frames = append(anim.Frames, apngFrame{
+			DelayNum: binary.BigEndian.Uint16(raw.fctl[20:]),
+			DelayDen: binary.BigEndian.Uint16(raw.fctl[22:]),
+		})
+
+		switch dispose {
+		case apngDisposeBackground:
+			draw.Draw(canvas, rect, image.Transparent, image.Point{}, draw.Src)
+		case apngDisposePrevious:
+			draw.Draw(canvas, rect, previous, rect.Min, draw.Src)
+		}
+	}
+	return anim, nil
+}
+
+// encodeAPNG はimagesを各フレームとするAPNGをwに書き出します。フレームの表示時間と繰り返し回数はanimのものを使います。
+// すべてのフレームは同じ大きさで、画像全体を置き換える(dispose_op NONE, blend_op SOURCE)フレームとして書き出します。
+// 色は8bitのRGBAで出力します。
+func encodeAPNG(w io.Writer, images []image.Image, anim *apngAnimation) error {
+	if len(images) == 0 || len(images) != len(anim.Frames) {
+		return errors.New("frame count mismatch")
+	}
+	b := images[0].Bounds()
+
+	if _, err := io.WriteString(w, pngSignature); err != nil {
+		return err
+	}
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr, uint32(b.Dx()))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(b.Dy()))
+	ihdr[8], ihdr[9] = 8, 6 // 8bit, RGBA
+	if err := writePNGChunk(w, "IHDR", ihdr); err != nil {
+		return err
+	}
+	actl := make([]byte, 8)
+	binary.BigEndian.PutUint32(actl, uint32(len(images)))
+	binary.BigEndian.PutUint32(actl[4:], anim.Plays)
+	if err := writePNGChunk(w, "acTL", actl); err != nil {
+		return err
+	}
+
+	var seq uint32
+	for i, img := range images {
+		if !img.Bounds().Size().Eq(b.Size()) {
+			return fmt.Errorf("frame %d has a different size", i)
+		}
+		fctl := make([]byte, 26)
+		binary.BigEndian.PutUint32(fctl, seq)
+		binary.BigEndian.PutUint32(fctl[4:], uint32(b.Dx()))
+		binary.BigEndian.PutUint32(fctl[8:], uint32(b.Dy()))
+		binary.BigEndian.PutUint16(fctl[20:], anim.Frames[i].DelayNum)
+		binary.BigEndian.PutUint16(fctl[22:], anim.Frames[i].DelayDen)
+		fctl[24], fctl[25] = apngDisposeNone, apngBlendSource
+		if err := writePNGChunk(w, "fcTL", fctl); err != nil {
+			return err
+		}
+		seq++
+
+		data, err := compressRGBA(img)
+		if err != nil {
+			return err
+		}
+		// 最初のフレームは既定の画像を兼ねてIDATに、以降はシーケンス番号を付けたfdATに入れる。
+		if i == 0 {
+			err = writePNGChunk(w, "IDAT", data)
+		} else {
+			fdat := make([]byte, 4, 4+len(data))
+			binary.BigEndian.PutUint32(fdat, seq)
+			err = writePNGChunk(w, "fdAT", append(fdat, data...))
+			seq++
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return writePNGChunk(w, "IEND", nil)
+}
+
+// compressRGBA はimgを8bitのRGBA(非乗算)の画素データとしてフィルタを掛け、zlibで圧縮します。
+// フィルタは行ごとに、フィルタ後の値の絶対値の和が最も小さくなるものを選びます。
+func compressRGBA(img image.Image) ([]byte, error) {
+	b := img.Bounds()
+	nrgba := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(nrgba, nrgba.Bounds(), img, b.Min, draw.Src)
+
+	const bpp = 4
+	stride := b.Dx() * bpp
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	prev := make([]byte, stride)
+	filtered := make([][]byte, 5)
+	for i := range filtered {
+		filtered[i] = make([]byte, stride+1)
+		filtered[i][0] = byte(i)
+	}
+	for y := 0; y < b.Dy(); y++ {
+		row := nrgba.Pix[y*nrgba.Stride : y*nrgba.Stride+stride]
+		best, bestSum := 0, -1
+		for ft := range filtered {
+			out := filtered[ft][1:]
+			sum := 0
+			for x := 0; x < stride; x++ {
+				var left, upLeft byte
+				if x >= bpp {
+					left, upLeft = row[x-bpp], prev[x-bpp]
+				}
+				up := prev[x]
+				var v byte
+				switch ft {
+				case 0:
+					v = row[x]
+				case 1:
+					v = row[x] - left
+				case 2:
+					v = row[x] - up
+				case 3:
+					v = row[x] - byte((int(left)+int(up))/2)
+				case 4:
+					v = row[x] - paeth(left, up, upLeft)
+				}
+				out[x] = v
+				sum += abs(int(int8(v)))
+			}
+			if bestSum < 0 || sum < bestSum {
+				best, bestSum = ft, sum
+			}
+		}
+		if _, err := zw.Write(filtered[best]); err != nil {
+			return nil, err
+		}
+		prev = row
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// paeth はPNGのPaethフィルタの予測値を返します。
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	} else if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
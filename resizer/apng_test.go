@@ -0,0 +1,174 @@
+package resizer
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// totalDelay はanimの全フレームの表示時間の合計(秒)を返します。分母の0は100として扱います。
+func totalDelay(anim *apngAnimation) float64 {
+	s := 0.0
+	for _, f := range anim.Frames {
+		den := f.DelayDen
+		if den == 0 {
+			den = 100
+		}
+		s += float64(f.DelayNum) / float64(den)
+	}
+	return s
+}
+
+// writeAPNG はフレームiを灰色i*50で塗った40×20のフレームを、delaysの表示時間で並べたアニメーションPNGを書き出します。
+func writeAPNG(t *testing.T, dir string, delays [][2]uint16) (string, *apngAnimation) {
+	t.Helper()
+	anim := &apngAnimation{}
+	var frames []image.Image
+	for i, d := range delays {
+		img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+		v := uint8(i * 50)
+		for p := 0; p < len(img.Pix); p += 4 {
+			img.Pix[p], img.Pix[p+1], img.Pix[p+2], img.Pix[p+3] = v, v, v, 255
+		}
+		frames = append(frames, img)
+		anim.Frames = append(anim.Frames, apngFrame{DelayNum: d[0], DelayDen: d[1]})
+	}
+	var buf bytes.Buffer
+	if err := encodeAPNG(&buf, frames, anim); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(dir, "anim.png")
+	if err := os.WriteFile(p, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p, anim
+}
+
+func TestFrameStep(t *testing.T) {
+	delays := [][2]uint16{{1, 10}, {1, 10}, {3, 100}, {1, 3}, {50, 1000}}
+	tests := []struct {
+		name       string
+		step       int
+		wantFrames []int
+	}{
+		{"off", 0, []int{0, 1, 2, 3, 4}},
+		{"1", 1, []int{0, 1, 2, 3, 4}},
+		{"2", 2, []int{0, 2, 4}},
+		{"3", 3, []int{0, 3}},
+		{"longer than animation", 10, []int{0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src, anim := writeAPNG(t, dir, delays)
+			r, err := ResizeImage(src, Options{Width: 20, FrameStep: tt.step, OutputDir: filepath.Join(dir, "out")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := os.Open(r.OutputPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			var gray []uint8
+			out, err := decodeAPNG(f, 0, func(i int, canvas *image.RGBA) error {
+				if canvas.Bounds() != image.Rect(0, 0, 20, 10) {
+					t.Errorf("frame %d is %v, want 20x10", i, canvas.Bounds())
+				}
+				gray = append(gray, color.GrayModel.Convert(canvas.At(10, 5)).(color.Gray).Y)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if r.Frames != len(tt.wantFrames) || len(out.Frames) != len(tt.wantFrames) {
+				t.Fatalf("%d frames (result %d), want %d", len(out.Frames), r.Frames, len(tt.wantFrames))
+			}
+			for i, src := range tt.wantFrames {
+				if want := uint8(src * 50); gray[i] != want {
+					t.Errorf("frame %d is gray %d, want %d from source frame %d", i, gray[i], want, src)
+				}
+			}
+			if got, want := totalDelay(out), totalDelay(anim); math.Abs(got-want) > 1e-9 {
+				t.Errorf("total duration %gs, want %gs", got, want)
+			}
+		})
+	}
+}
+
+func TestFrameStepRejectsNonAPNG(t *testing.T) {
+	// 4フレームのGIFアニメーションです。
+	writeGIF := func(t *testing.T, dir string) string {
+		anim := &gif.GIF{}
+		for range 4 {
+			anim.Image = append(anim.Image, image.NewPaletted(image.Rect(0, 0, 40, 20), color.Palette{color.Black, color.White}))
+			anim.Delay = append(anim.Delay, 10)
+		}
+		var buf bytes.Buffer
+		if err := gif.EncodeAll(&buf, anim); err != nil {
+			t.Fatal(err)
+		}
+		p := filepath.Join(dir, "anim.gif")
+		if err := os.WriteFile(p, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	writeAnim := func(t *testing.T, dir string) string {
+		p, _ := writeAPNG(t, dir, [][2]uint16{{1, 10}, {1, 10}, {1, 10}})
+		return p
+	}
+	tests := []struct {
+		name  string
+		write func(t *testing.T, dir string) string
+		opt   Options
+	}{
+		{"gif animation", writeGIF, Options{}},
+		{"still png", func(t *testing.T, dir string) string { return writePNG(t, dir, "a.png", gradient(40, 20)) }, Options{}},
+		{"jpeg", func(t *testing.T, dir string) string { return writeJPEG(t, dir, "a.jpg", gradient(40, 20)) }, Options{}},
+		{"apng to webp", writeAnim, Options{OutFormat: TYPE_WEBP}},
+		{"apng to tiles", writeAnim, Options{Tile: 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := tt.write(t, dir)
+			tt.opt.Width, tt.opt.FrameStep, tt.opt.OutputDir = 20, 2, filepath.Join(dir, "out")
+			if _, err := ResizeImage(src, tt.opt); !errors.Is(err, ErrNotAnimated) {
+				t.Errorf("error = %v, want %v", err, ErrNotAnimated)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "out")); !os.IsNotExist(err) {
+				t.Errorf("output directory was created: %v", err)
+			}
+		})
+	}
+}
+
+func TestAddDelay(t *testing.T) {
+	tests := []struct {
+		name                   string
+		aNum, aDen, bNum, bDen uint16
+		wantNum, wantDen       uint16
+	}{
+		{"same unit", 1, 10, 2, 10, 3, 10},
+		{"different units", 1, 10, 3, 100, 13, 100},
+		{"zero denominator", 5, 0, 1, 10, 15, 100},
+		{"thirds", 1, 3, 1, 2, 5, 6},
+		{"rounded", 60000, 60001, 1, 60000, 1000, 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			num, den := addDelay(tt.aNum, tt.aDen, tt.bNum, tt.bDen)
+			if num != tt.wantNum || den != tt.wantDen {
+				t.Errorf("addDelay = %d/%d, want %d/%d", num, den, tt.wantNum, tt.wantDen)
+			}
+		})
+	}
+}
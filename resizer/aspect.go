@@ -0,0 +1,79 @@
+package resizer
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+)
+
+// -gravityで指定できる、縦横比に合わせて切り抜くときに残す位置です。
+const (
+	GRAVITY_CENTER       = "center"
+	GRAVITY_TOP          = "top"
+	GRAVITY_BOTTOM       = "bottom"
+	GRAVITY_LEFT         = "left"
+	GRAVITY_RIGHT        = "right"
+	GRAVITY_TOP_LEFT     = "topleft"
+	GRAVITY_TOP_RIGHT    = "topright"
+	GRAVITY_BOTTOM_LEFT  = "bottomleft"
+	GRAVITY_BOTTOM_RIGHT = "bottomright"
+)
+
+// gravities は各gravityで、余る幅・高さのうち左・上に割り当てる割合(0, 1/2, 1)を2倍した値です。
+var gravities = map[string]image.Point{
+	GRAVITY_CENTER:       {1, 1},
+	GRAVITY_TOP:          {1, 0},
+	GRAVITY_BOTTOM:       {1, 2},
+	GRAVITY_LEFT:         {0, 1},
+	GRAVITY_RIGHT:        {2, 1},
+	GRAVITY_TOP_LEFT:     {0, 0},
+	GRAVITY_TOP_RIGHT:    {2, 0},
+	GRAVITY_BOTTOM_LEFT:  {0, 2},
+	GRAVITY_BOTTOM_RIGHT: {2, 2},
+}
+
+// IsGravity はnameがOptions.Gravityに指定できる位置かどうかを返します。
+func IsGravity(name string) bool {
+	_, ok := gravities[name]
+	return ok
+}
+
+// ParseAspect は"16:9"の形式の縦横比を幅と高さの比に分けて返します。
+func ParseAspect(s string) (int, int, error) {
+	ws, hs, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("%q is not in W:H form", s)
+	}
+	w, err := strconv.Atoi(ws)
+	if err != nil {
+		return 0, 0, err
+	}
+	h, err := strconv.Atoi(hs)
+	if err != nil {
+		return 0, 0, err
+	}
+	if w < 1 || h < 1 {
+		return 0, 0, fmt.Errorf("%q must be positive", s)
+	}
+	return w, h, nil
+}
+
+// aspectCrop はrから縦横比aw:ahの最も大きい矩形を、gravityの位置に寄せて切り出します。
+// gravityが空の場合は中央から切り出します。
+func aspectCrop(r image.Rectangle, aw, ah int, gravity string) image.Rectangle {
+	w, h := r.Dx(), r.Dy()
+	// 幅・高さを比に合わせて切り詰める。大きな画像でも溢れないよう64bitで計算する。
+	if int64(w)*int64(ah) > int64(h)*int64(aw) {
+		w = max(1, int(int64(h)*int64(aw)/int64(ah)))
+	} else {
+		h = max(1, int(int64(w)*int64(ah)/int64(aw)))
+	}
+	g, ok := gravities[gravity]
+	if !ok {
+		g = gravities[GRAVITY_CENTER]
+	}
+	x0 := r.Min.X + (r.Dx()-w)*g.X/2
+	y0 := r.Min.Y + (r.Dy()-h)*g.Y/2
+	return image.Rect(x0, y0, x0+w, y0+h)
+}
@@ -0,0 +1,65 @@
+package resizer
+
+import (
+	"image"
+	"path/filepath"
+	"testing"
+)
+
+func TestAspectCrop(t *testing.T) {
+	landscape, portrait := image.Rect(0, 0, 400, 300), image.Rect(0, 0, 300, 400)
+	tests := []struct {
+		name    string
+		r       image.Rectangle
+		aw, ah  int
+		gravity string
+		want    image.Rectangle
+	}{
+		{"landscape 16:9 center", landscape, 16, 9, GRAVITY_CENTER, image.Rect(0, 37, 400, 262)},
+		{"landscape 16:9 default", landscape, 16, 9, "", image.Rect(0, 37, 400, 262)},
+		{"landscape 16:9 top", landscape, 16, 9, GRAVITY_TOP, image.Rect(0, 0, 400, 225)},
+		{"landscape 16:9 bottom", landscape, 16, 9, GRAVITY_BOTTOM, image.Rect(0, 75, 400, 300)},
+		{"landscape 1:1 left", landscape, 1, 1, GRAVITY_LEFT, image.Rect(0, 0, 300, 300)},
+		{"landscape 1:1 right", landscape, 1, 1, GRAVITY_RIGHT, image.Rect(100, 0, 400, 300)},
+		{"portrait 16:9 center", portrait, 16, 9, GRAVITY_CENTER, image.Rect(0, 116, 300, 284)},
+		{"portrait 16:9 bottomright", portrait, 16, 9, GRAVITY_BOTTOM_RIGHT, image.Rect(0, 232, 300, 400)},
+		{"portrait 9:16 center", portrait, 9, 16, GRAVITY_CENTER, image.Rect(37, 0, 262, 400)},
+		{"offset source", image.Rect(10, 20, 410, 320), 1, 1, GRAVITY_TOP_LEFT, image.Rect(10, 20, 310, 320)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := aspectCrop(tt.r, tt.aw, tt.ah, tt.gravity); got != tt.want {
+				t.Errorf("aspectCrop = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResizeAspectCrop(t *testing.T) {
+	tests := []struct {
+		name         string
+		srcW, srcH   int
+		opt          Options
+		wantW, wantH int
+	}{
+		{"portrait to 16:9 width", 300, 400, Options{Width: 320, AspectWidth: 16, AspectHeight: 9}, 320, 180},
+		{"portrait to 16:9 only", 300, 400, Options{AspectWidth: 16, AspectHeight: 9}, 300, 168},
+		{"landscape to 1:1 height", 400, 300, Options{Height: 100, AspectWidth: 1, AspectHeight: 1}, 100, 100},
+		{"landscape to 9:16", 400, 300, Options{Height: 160, AspectWidth: 9, AspectHeight: 16, Gravity: GRAVITY_RIGHT}, 90, 160},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := writeJPEG(t, dir, "a.jpg", gradient(tt.srcW, tt.srcH))
+			tt.opt.OutputDir = filepath.Join(dir, "out")
+			r, err := ResizeImage(src, tt.opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, _ := decodeFile(t, r.OutputPath)
+			if want := image.Rect(0, 0, tt.wantW, tt.wantH); out.Bounds() != want {
+				t.Errorf("output is %v, want %v", out.Bounds(), want)
+			}
+		})
+	}
+}
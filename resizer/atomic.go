@@ -0,0 +1,104 @@
+package resizer
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// outputFilePerm は出力ファイルのパーミッションです。
+const outputFilePerm = 0644
+
+// outputFile は一時ファイルに書き込み、Commitで出力先のパスに置き換える出力ファイルです。
+// Commitする前にCloseした場合は一時ファイルを削除し、出力先のファイルは変更しません。
+type outputFile struct {
+	*os.File
+	path      string
+	perm      os.FileMode
+	committed bool
+}
+
+// createAtomic はpathへの出力用に、tmpDirに一時ファイルを作成します。tmpDirが空の場合はpathと同じディレクトリに作成します。
+func createAtomic(path, tmpDir string) (*outputFile, error) {
+	if tmpDir == "" {
+		tmpDir = filepath.Dir(path)
+	}
+	f, err := os.CreateTemp(tmpDir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &outputFile{File: f, path: path, perm: outputFilePerm}, nil
+}
+
+// createReplacement はsrcPath自身を置き換えるための出力ファイルを作成します。置き換えた後もsrcPathのパーミッションを保ちます。
+func createReplacement(srcPath, tmpDir string) (*outputFile, error) {
+	fi, err := os.Stat(srcPath)
+	if err != nil {
+		return nil, err
+	}
+	f, err := createAtomic(srcPath, tmpDir)
+	if err != nil {
+		return nil, err
+	}
+	f.perm = fi.Mode().Perm()
+	return f, nil
+}
+
+// Name は出力先のパスを返します。
+func (f *outputFile) Name() string {
+	return f.path
+}
+
+// Commit は一時ファイルを閉じて出力先のパスに移動します。
+// 一時ファイルが出力先と別のファイルシステムにあり移動できない場合は、出力先のディレクトリにコピーしてから置き換えます。
+func (f *outputFile) Commit() error {
+	f.committed = true
+	tmpPath := f.File.Name()
+	defer os.Remove(tmpPath)
+
+	if err := f.File.Chmod(f.perm); err != nil {
+		f.File.Close()
+		return err
+	}
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+	err := os.Rename(tmpPath, f.path)
+	if errors.Is(err, syscall.EXDEV) {
+		return copyReplace(tmpPath, f.path, f.perm)
+	}
+	return err
+}
+
+// Close はCommitされていない場合、一時ファイルを閉じて削除します。Commit後は何もしません。
+func (f *outputFile) Close() error {
+	if f.committed {
+		return nil
+	}
+	f.committed = true
+	err := f.File.Close()
+	os.Remove(f.File.Name())
+	return err
+}
+
+// copyReplace はsrcPathの内容をdstPathと同じディレクトリの一時ファイルにコピーし、パーミッションをpermにしてdstPathに置き換えます。
+func copyReplace(srcPath, dstPath string, perm os.FileMode) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := createAtomic(dstPath, "")
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	dst.perm = perm
+	if _, err := io.Copy(dst, src); err != nil {
+		return err
+	}
+	return dst.Commit()
+}
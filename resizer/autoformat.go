@@ -0,0 +1,61 @@
+package resizer
+
+import "image"
+
+// FORMAT_AUTO_SMART はOptions.OutFormatに指定すると、縮小後の画像の内容から写真はJPEG、図やイラストはPNGで出力します。
+const FORMAT_AUTO_SMART = "auto-smart"
+
+// DefaultAutoFormatMaxColors, DefaultAutoFormatFlatRatio はFORMAT_AUTO_SMARTで図と判定するしきい値の既定値です。
+const (
+	DefaultAutoFormatMaxColors = 256
+	DefaultAutoFormatFlatRatio = 0.6
+)
+
+// smartFormat は縮小後の画像imgを出力する形式を、次の順に判定して返します。
+//  1. 透過のある画素がある、またはopt.ColorModelがCOLOR_RGBAの場合はPNG(JPEGでは透過を扱えないため)。
+//  2. 色数がopt.AutoFormatMaxColors以下の場合はPNG(ロゴやアイコンなど、少ない色で塗られた図)。
+//  3. 右隣と同じ色の画素の割合がopt.AutoFormatFlatRatio以上の場合はPNG(スクリーンショットなど、平らな面の多い図)。
+//  4. それ以外はJPEG(色数が多く、細かな濃淡のある写真)。
+//
+// しきい値が0の場合は既定値を使います。
+func smartFormat(img image.Image, opt Options) string {
+	maxColors, flatRatio := opt.AutoFormatMaxColors, opt.AutoFormatFlatRatio
+	if maxColors <= 0 {
+		maxColors = DefaultAutoFormatMaxColors
+	}
+	if flatRatio <= 0 {
+		flatRatio = DefaultAutoFormatFlatRatio
+	}
+
+	if opt.ColorModel == COLOR_RGBA || !isOpaque(img) {
+		return TYPE_PNG
+	}
+
+	b := img.Bounds()
+	colors := make(map[uint32]struct{}, maxColors+1)
+	var flat, pairs int
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		var prev uint32
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			c := r>>8<<16 | g>>8<<8 | bl>>8
+			if len(colors) <= maxColors {
+				colors[c] = struct{}{}
+			}
+			if x > b.Min.X {
+				pairs++
+				if c == prev {
+					flat++
+				}
+			}
+			prev = c
+		}
+	}
+	if len(colors) <= maxColors {
+		return TYPE_PNG
+	}
+	if pairs > 0 && float64(flat)/float64(pairs) >= flatRatio {
+		return TYPE_PNG
+	}
+	return TYPE_JPG
+}
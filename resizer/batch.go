@@ -0,0 +1,159 @@
+package resizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// BatchResize はinputsの各ファイルをoptに従ってリサイズし、inputsと同じ順番で結果を返します。
+// 失敗したファイルや、opt.FailFastによる中断で処理されなかったファイルの結果はErrにエラーが入ります。
+// opt.Workersが2以上の場合は、その数のファイルを並行して処理します。
+func BatchResize(inputs []string, opt Options) []Result {
+	return BatchResizeContext(context.Background(), inputs, opt)
+}
+
+// BatchResizeContext はBatchResizeと同じ処理を行います。ctxがキャンセルされた場合は、処理中のファイルを中断し、
+// まだ始めていないファイルとともにErrSkippedのエラーを結果に入れて返します。
+func BatchResizeContext(parent context.Context, inputs []string, opt Options) []Result {
+	results := make([]Result, len(inputs))
+
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if opt.TotalTimeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, opt.TotalTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
+	defer cancel()
+
+	workers := max(1, opt.Workers)
+	if opt.MaxConcurrentDecodes > 0 {
+		opt.decodes = make(decodeLimiter, opt.MaxConcurrentDecodes)
+	}
+	var (
+		mu   sync.Mutex
+		seq  = opt.SequenceStart
+		done int
+		// finished, notifyはOrderedResultsで、終わったファイルと、そのうちOnResultを呼び出すファイルです。
+		// nextより前のファイルはすべて知らせ終わっています。
+		finished = make([]bool, len(inputs))
+		notify   = make([]bool, len(inputs))
+		next     int
+	)
+	// progress は1ファイル分の処理が終わったことをOnProgressに知らせます。muを確保した状態で呼び出します。
+	progress := func(srcPath string) {
+		done++
+		if opt.OnProgress != nil {
+			opt.OnProgress(done, len(inputs), srcPath)
+		}
+	}
+	// report はi番目のファイルの処理が終わったことを、withResultの場合はOnResultにも知らせます。muを確保した状態で呼び出します。
+	// OrderedResultsが有効な場合は、前のファイルがすべて終わるまで知らせるのを待ちます。
+	report := func(i int, withResult bool) {
+		if !opt.OrderedResults {
+			if withResult && opt.OnResult != nil {
+				opt.OnResult(i, results[i])
+			}
+			progress(inputs[i])
+			return
+		}
+		finished[i], notify[i] = true, withResult
+		for ; next < len(inputs) && finished[next]; next++ {
+			if notify[next] && opt.OnResult != nil {
+				opt.OnResult(next, results[next])
+			}
+			progress(inputs[next])
+		}
+	}
+	resize := func(i int) {
+		srcPath := inputs[i]
+		if err := ctx.Err(); err != nil {
+			mu.Lock()
+			defer mu.Unlock()
+			results[i] = skippedResult(srcPath, err)
+			report(i, false)
+			return
+		}
+
+		fileOpt := opt
+		if opt.Sequence != "" {
+			// 1ファイルずつ処理する場合は成功したファイルにだけ連番を振る。
+			// 並行して処理する場合は処理の順番が決まらないため、入力の順番で振る。
+			n := opt.SequenceStart + i
+			if workers == 1 {
+				mu.Lock()
+				n = seq
+				mu.Unlock()
+			}
+			fileOpt.OutName = fmt.Sprintf("%s%0*d", opt.Sequence, opt.SequencePad, n)
+		}
+
+		r, err := resizeWithTimeout(ctx, srcPath, fileOpt, opt.FileTimeout)
+
+		mu.Lock()
+		defer mu.Unlock()
+		// 他のファイルのエラーで中断された場合は、このファイルも処理されなかったものとする。
+		if err != nil && ctx.Err() != nil {
+			results[i] = skippedResult(srcPath, ctx.Err())
+			report(i, false)
+			return
+		}
+		if err != nil {
+			results[i] = Result{SourcePath: srcPath, Err: err}
+			// しきい値による読み飛ばしと、読み飛ばす指定のある対応していない形式はエラーとして扱わない。
+			if opt.FailFast && !errors.Is(err, ErrBelowThreshold) && !(opt.SkipUnsupported && errors.Is(err, ErrUnsupportedFormat)) {
+				cancel()
+			}
+		} else {
+			results[i] = *r
+			seq++
+		}
+		report(i, true)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				resize(i)
+			}
+		}()
+	}
+	for i := range inputs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// skippedResult はバッチの中断によって処理されなかったsrcPathの結果を返します。
+func skippedResult(srcPath string, cause error) Result {
+	return Result{SourcePath: srcPath, Err: fmt.Errorf("%w: %w", ErrSkipped, cause)}
+}
+
+// decodeLimiter は同時にデコードして元のサイズのまま保持する画像の数を制限するセマフォです。nilの場合は制限しません。
+type decodeLimiter chan struct{}
+
+// acquire は空きができるまで待ってから枠を1つ確保し、枠を返す関数を返します。返した関数は何度呼んでも1回だけ枠を返します。
+// 待っている間にctxがキャンセルされた場合はctxのエラーを返します。
+func (l decodeLimiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	select {
+	case l <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	var once sync.Once
+	return func() { once.Do(func() { <-l }) }, nil
+}
@@ -0,0 +1,38 @@
+package resizer
+
+import (
+	"image"
+	"os"
+
+	"golang.org/x/image/draw"
+)
+
+// LoadBackgroundImage はpathの画像をBackgroundImageとして使うために読み込みます。
+func LoadBackgroundImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	return fullColor(img), nil
+}
+
+// fitBackground はbgを縦横比を保ったままrいっぱいに拡大・縮小した画像を返します。はみ出す部分は中央を残して切り取ります。
+func fitBackground(bg image.Image, r image.Rectangle, opt Options) draw.RGBA64Image {
+	dst := newCanvas(bg, r)
+	scalerFor(opt).Scale(dst, r, bg, fitRect(r, bg.Bounds()), draw.Src, nil)
+	return dst
+}
+
+// overBackground はbgの上にimgを重ねた画像を返します。bgはimgと同じ大きさである必要があります。
+func overBackground(img, bg draw.RGBA64Image) draw.RGBA64Image {
+	b := img.Bounds()
+	dst := newCanvas(img, b)
+	draw.Draw(dst, b, bg, bg.Bounds().Min, draw.Src)
+	draw.Draw(dst, b, img, b.Min, draw.Over)
+	return dst
+}
@@ -0,0 +1,115 @@
+package resizer
+
+import (
+	"image"
+	"image/color"
+)
+
+// chromaGuideEps は色差を輝度から推定するときに、輝度の分散に足して傾きを0に近づける量です。
+// 輝度がほぼ平らな部分では、ノイズから傾きを推定しないよう元の色差をそのまま使います。
+const chromaGuideEps = 25
+
+// chromaFactors はYCbCrのサブサンプリングの比率ごとに、輝度の何画素分が色差の1画素になるかを横・縦の順に返します。
+func chromaFactors(ratio image.YCbCrSubsampleRatio) (int, int) {
+	switch ratio {
+	case image.YCbCrSubsampleRatio422:
+		return 2, 1
+	case image.YCbCrSubsampleRatio420:
+		return 2, 2
+	case image.YCbCrSubsampleRatio440:
+		return 1, 2
+	case image.YCbCrSubsampleRatio411:
+		return 4, 1
+	case image.YCbCrSubsampleRatio410:
+		return 4, 2
+	}
+	return 1, 1
+}
+
+// upsampleYCbCr は色差がサブサンプリングされたsrcを、色差を輝度と同じ解像度に戻してから*image.RGBAに変換します。
+//
+// image.YCbCrのAtや縮小処理は、色差の1画素(4:2:0では輝度の2×2画素)の中ではすべて同じ色差を使います。
+// 赤と青の境界のような色の急な変化が色差の画素の区切りに合わない位置にあると、境界の片側の1画素に
+// 平均された色差が使われ、反対側の色がにじみます。周りの色差から線形補間しても、このにじみは消えません。
+//
+// ここでは色差の画素ごとに、周り3×3の色差の画素の範囲で輝度と色差の関係を直線で近似し、
+// 各画素の輝度とその色差の画素内の平均輝度の差から色差を補正します。色差の画素内の平均は元のまま保たれ、
+// 輝度が平らな部分では補正しないため、境界のない部分の色は変わりません。
+func upsampleYCbCr(src *image.YCbCr) *image.RGBA {
+	r := src.Rect
+	fx, fy := chromaFactors(src.SubsampleRatio)
+	cx0, cy0 := r.Min.X/fx, r.Min.Y/fy
+	cw, ch := (r.Max.X+fx-1)/fx-cx0, (r.Max.Y+fy-1)/fy-cy0
+	// 各列が何番目の色差の列に入るか。
+	cols := make([]int, r.Dx())
+	for x := range cols {
+		cols[x] = (r.Min.X+x)/fx - cx0
+	}
+
+	// 色差の画素ごとの平均輝度。
+	yMean := make([]float32, cw*ch)
+	yCount := make([]float32, cw*ch)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		row := src.Y[(y-r.Min.Y)*src.YStride:]
+		means, counts := yMean[(y/fy-cy0)*cw:], yCount[(y/fy-cy0)*cw:]
+		for x, cx := range cols {
+			means[cx] += float32(row[x])
+			counts[cx]++
+		}
+	}
+	for i := range yMean {
+		yMean[i] /= yCount[i]
+	}
+
+	// 色差の画素ごとの、輝度に対するCb, Crの傾き。
+	slopeCb := make([]float32, cw*ch)
+	slopeCr := make([]float32, cw*ch)
+	for cy := 0; cy < ch; cy++ {
+		for cx := 0; cx < cw; cx++ {
+			var n, sy, sb, sr, syy, syb, syr float32
+			for j := max(0, cy-1); j <= min(ch-1, cy+1); j++ {
+				for i := max(0, cx-1); i <= min(cw-1, cx+1); i++ {
+					yy := yMean[j*cw+i]
+					b := float32(src.Cb[j*src.CStride+i])
+					c := float32(src.Cr[j*src.CStride+i])
+					n++
+					sy, sb, sr = sy+yy, sb+b, sr+c
+					syy, syb, syr = syy+yy*yy, syb+yy*b, syr+yy*c
+				}
+			}
+			mean := sy / n
+			variance := syy/n - mean*mean
+			slopeCb[cy*cw+cx] = (syb/n - mean*sb/n) / (variance + chromaGuideEps)
+			slopeCr[cy*cw+cx] = (syr/n - mean*sr/n) / (variance + chromaGuideEps)
+		}
+	}
+
+	dst := image.NewRGBA(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		yRow := src.Y[(y-r.Min.Y)*src.YStride:]
+		dRow := dst.Pix[(y-r.Min.Y)*dst.Stride:]
+		cy := y/fy - cy0
+		cbRow, crRow := src.Cb[cy*src.CStride:], src.Cr[cy*src.CStride:]
+		means, sb, sr := yMean[cy*cw:], slopeCb[cy*cw:], slopeCr[cy*cw:]
+		for x, cx := range cols {
+			yy := yRow[x]
+			d := float32(yy) - means[cx]
+			b := clampUint8(float32(cbRow[cx]) + sb[cx]*d)
+			c := clampUint8(float32(crRow[cx]) + sr[cx]*d)
+			rr, gg, bb := color.YCbCrToRGB(yy, b, c)
+			dRow[4*x], dRow[4*x+1], dRow[4*x+2], dRow[4*x+3] = rr, gg, bb, 0xff
+		}
+	}
+	return dst
+}
+
+// clampUint8 はvを四捨五入して0〜255に収めます。
+func clampUint8(v float32) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
@@ -0,0 +1,92 @@
+package resizer
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/image/draw"
+)
+
+// redBlue は左のedge列までが赤、それより右が青の64×64の画像を返します。
+func redBlue(edge int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			c := color.RGBA{255, 0, 0, 255}
+			if x >= edge {
+				c = color.RGBA{0, 0, 255, 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// maxChannelDiff はa, bの同じ位置の画素のR, G, Bの差の最大値を返します。
+func maxChannelDiff(a, b image.Image) int {
+	m := 0
+	r := a.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			r1, g1, b1, _ := a.At(x, y).RGBA()
+			r2, g2, b2, _ := b.At(x, y).RGBA()
+			m = max(m, abs(int(r1>>8)-int(r2>>8)), abs(int(g1>>8)-int(g2>>8)), abs(int(b1>>8)-int(b2>>8)))
+		}
+	}
+	return m
+}
+
+func TestChromaEdgeDoesNotSmear(t *testing.T) {
+	tests := []struct {
+		name       string
+		edge, size int
+		// naiveSmears はデコードしたYCbCrをそのまま縮小するとmaxSmearを超えてにじむかどうかです。
+		naiveSmears bool
+	}{
+		{"aligned", 32, 48, false},
+		{"odd edge", 31, 48, true},
+		{"odd edge half", 33, 32, false},
+		{"odd edge same size", 31, 64, true},
+	}
+	const maxSmear = 16
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			org := redBlue(tt.edge)
+			dir := t.TempDir()
+			// image/jpegは4:2:0でエンコードする。
+			src := writeJPEG(t, dir, "a.jpg", org)
+			r, err := ResizeImage(src, Options{Width: tt.size, OutFormat: TYPE_PNG, AllowUpscale: true, OutputDir: filepath.Join(dir, "out")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := decodeFile(t, r.OutputPath)
+
+			// 元の画像を同じ大きさに縮小したものと比べる。
+			want := image.NewRGBA(image.Rect(0, 0, tt.size, tt.size))
+			scalerFor(Options{}).Scale(want, want.Bounds(), org, org.Bounds(), draw.Src, nil)
+			// デコードしたYCbCrをそのまま縮小した場合は、境界が色差の画素の区切りに合わないと色がにじむ。
+			f, err := os.Open(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dec, err := jpeg.Decode(f)
+			f.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			naive := image.NewRGBA(want.Bounds())
+			scalerFor(Options{}).Scale(naive, naive.Bounds(), dec, dec.Bounds(), draw.Src, nil)
+
+			if d := maxChannelDiff(want, got); d > maxSmear {
+				t.Errorf("output differs from the scaled original by %d", d)
+			}
+			if d := maxChannelDiff(want, naive); (d > maxSmear) != tt.naiveSmears {
+				t.Errorf("naive scaling differs by %d, want smearing=%v", d, tt.naiveSmears)
+			}
+		})
+	}
+}
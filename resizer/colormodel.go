@@ -0,0 +1,102 @@
+package resizer
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"golang.org/x/image/draw"
+)
+
+// Options.ColorModelに指定できるカラーモデルです。
+const (
+	COLOR_RGB  = "rgb"
+	COLOR_RGBA = "rgba"
+	COLOR_GRAY = "gray"
+)
+
+// CheckColorModel はカラーモデルmodelの画像をformatの形式で出力できるかを確認します。
+func CheckColorModel(model, format string) error {
+	switch model {
+	case "", COLOR_RGB, COLOR_GRAY:
+	case COLOR_RGBA:
+		if format == TYPE_JPG {
+			return fmt.Errorf("%w: %s cannot be encoded as %s", ErrIncompatibleColorModel, model, format)
+		}
+	default:
+		return fmt.Errorf("%w: unknown color model %q", ErrIncompatibleColorModel, model)
+	}
+	return nil
+}
+
+// convertColorModel はimgをカラーモデルmodelの画像に変換します。modelが空の場合はimgをそのまま返します。
+// rgb, grayでは透過部分をbg(nilの場合は黒)と合成して不透明にします。16bitの画像は16bitのまま変換します。
+func convertColorModel(img image.Image, model string, bg color.Color) image.Image {
+	b := img.Bounds()
+	high := isHighBitDepth(img)
+
+	var dst draw.Image
+	switch model {
+	case COLOR_RGB:
+		if high {
+			dst = image.NewRGBA64(b)
+		} else {
+			dst = image.NewRGBA(b)
+		}
+	case COLOR_GRAY:
+		if high {
+			dst = image.NewGray16(b)
+		} else {
+			dst = image.NewGray(b)
+		}
+	case COLOR_RGBA:
+		if high {
+			dst = image.NewNRGBA64(b)
+		} else {
+			dst = image.NewNRGBA(b)
+		}
+		draw.Draw(dst, b, img, b.Min, draw.Src)
+		return dst
+	default:
+		return img
+	}
+
+	// 不透明な黒の上にbgを重ねてから画像を合成し、結果が必ず不透明になるようにする。
+	draw.Draw(dst, b, image.Black, image.Point{}, draw.Src)
+	if bg != nil {
+		draw.Draw(dst, b, image.NewUniform(bg), image.Point{}, draw.Over)
+	}
+	draw.Draw(dst, b, img, b.Min, draw.Over)
+	return dst
+}
+
+// isGraySource は入力画像がグレースケール(1チャンネル、または色差がすべて0のYCbCr)かどうかを返します。
+// 画素を1つずつ調べるのはYCbCrの色差だけで、それ以外の形式はfalseを返します。
+func isGraySource(img image.Image) bool {
+	switch m := img.(type) {
+	case *image.Gray, *image.Gray16:
+		return true
+	case *image.YCbCr:
+		for i := range m.Cb {
+			if m.Cb[i] != 128 || m.Cr[i] != 128 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// isNeutral はimgのすべての画素が不透明な無彩色(R=G=B)かどうかを返します。
+func isNeutral(img image.Image) bool {
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := img.At(x, y).RGBA()
+			if r != g || g != bl || a != 0xffff {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,41 @@
+package resizer
+
+import (
+	"image"
+	"image/color"
+	"path/filepath"
+	"testing"
+)
+
+func TestGrayscaleJPEGStaysGray(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 120, 80))
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i % 251)
+	}
+	tests := []struct {
+		name     string
+		src      image.Image
+		opt      Options
+		wantGray bool
+	}{
+		{"gray jpeg", gray, Options{Width: 60}, true},
+		{"gray to png", gray, Options{Width: 60, OutFormat: TYPE_PNG}, true},
+		{"colored padding", gray, Options{Width: 60, Pow2: true, Background: color.RGBA{255, 0, 0, 255}}, false},
+		{"color jpeg", gradient(120, 80), Options{Width: 60}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := writeJPEG(t, dir, "g.jpg", tt.src)
+			tt.opt.OutputDir = filepath.Join(dir, "out")
+			r, err := ResizeImage(src, tt.opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, _ := decodeFile(t, r.OutputPath)
+			if _, ok := out.(*image.Gray); ok != tt.wantGray {
+				t.Errorf("output is %T, want gray=%v", out, tt.wantGray)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package resizer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// MaxJPEGCommentSize はJPEGのCOMセグメントに入れられるコメントの最大バイト数です(セグメント長の2バイトを除いた分)。
+const MaxJPEGCommentSize = 0xffff - 2
+
+// pngCommentKeyword はPNGのテキストチャンクに使うキーワードです。
+const pngCommentKeyword = "Comment"
+
+// addComment はエンコード済みのformat形式の画像dataにcommentを埋め込んだものを返します。
+// JPEGはSOIの直後にCOMセグメントを、PNGはIHDRの直後にtEXtチャンク(ASCII以外を含む場合はUTF-8のiTXtチャンク)を入れます。
+func addComment(data []byte, format, comment string) ([]byte, error) {
+	switch format {
+	case TYPE_JPG:
+		if len(comment) > MaxJPEGCommentSize {
+			return nil, fmt.Errorf("comment is longer than %d bytes", MaxJPEGCommentSize)
+		}
+		if len(data) < 2 || data[0] != 0xff || data[1] != 0xd8 {
+			return nil, errors.New("not a jpeg")
+		}
+		var seg bytes.Buffer
+		seg.Write([]byte{0xff, 0xfe})
+		binary.Write(&seg, binary.BigEndian, uint16(len(comment)+2))
+		seg.WriteString(comment)
+		return insertBytes(data, 2, seg.Bytes()), nil
+	case TYPE_PNG:
+		typ, text := "tEXt", []byte(pngCommentKeyword+"\x00"+comment)
+		if !isASCII(comment) {
+			// キーワード、圧縮フラグ、圧縮方式、言語タグ、翻訳されたキーワード、本文の順に並ぶ。
+			typ, text = "iTXt", []byte(pngCommentKeyword+"\x00\x00\x00\x00\x00"+comment)
+		}
+		return addPNGChunks(data, []pngChunk{{typ: typ, data: text}})
+	}
+	return nil, fmt.Errorf("%w: cannot embed a comment in %s", ErrUnsupportedFormat, format)
+}
+
+// insertBytes はdataのoffsetの位置にinsを挿入したスライスを返します。
+func insertBytes(data []byte, offset int, ins []byte) []byte {
+	out := make([]byte, 0, len(data)+len(ins))
+	out = append(out, data[:offset]...)
+	out = append(out, ins...)
+	return append(out, data[offset:]...)
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
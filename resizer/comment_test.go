@@ -0,0 +1,117 @@
+package resizer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// jpegComments はJPEGのdataのSOSより前にあるCOMセグメントの内容を返します。
+func jpegComments(t *testing.T, data []byte) []string {
+	t.Helper()
+	var comments []string
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			t.Fatalf("no marker at offset %d", i)
+		}
+		marker := data[i+1]
+		if marker == 0xda {
+			break
+		}
+		n := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xfe {
+			comments = append(comments, string(data[i+4:i+2+n]))
+		}
+		i += 2 + n
+	}
+	return comments
+}
+
+// pngComments はPNGのdataのキーワードがCommentのtEXt, iTXtチャンクの本文を返します。
+func pngComments(t *testing.T, data []byte) []string {
+	t.Helper()
+	var comments []string
+	for _, c := range pngChunks(t, data) {
+		keyword, text, _ := bytes.Cut(c.data, []byte{0})
+		if string(keyword) != pngCommentKeyword {
+			continue
+		}
+		switch c.typ {
+		case "tEXt":
+			comments = append(comments, string(text))
+		case "iTXt":
+			// 圧縮フラグ、圧縮方式の後に言語タグ、翻訳されたキーワードがそれぞれ0で終わって続く。
+			parts := bytes.SplitN(text[2:], []byte{0}, 3)
+			comments = append(comments, string(parts[2]))
+		}
+	}
+	return comments
+}
+
+func TestCommentReadback(t *testing.T) {
+	tests := []struct {
+		format, comment string
+	}{
+		{TYPE_JPG, "generated-by: pipeline v2"},
+		{TYPE_JPG, "生成: パイプライン v2"},
+		{TYPE_PNG, "generated-by: pipeline v2"},
+		{TYPE_PNG, "生成: パイプライン v2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format+"/"+tt.comment, func(t *testing.T) {
+			dir := t.TempDir()
+			src := writeJPEG(t, dir, "a.jpg", gradient(40, 30))
+			r, err := ResizeImage(src, Options{Width: 20, OutFormat: tt.format, Comment: tt.comment, OutputDir: filepath.Join(dir, "out")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(r.OutputPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := image.Decode(bytes.NewReader(data)); err != nil {
+				t.Fatalf("output does not decode: %v", err)
+			}
+			var got []string
+			if tt.format == TYPE_JPG {
+				got = jpegComments(t, data)
+			} else {
+				got = pngComments(t, data)
+			}
+			if len(got) != 1 || got[0] != tt.comment {
+				t.Errorf("comments = %q, want [%q]", got, tt.comment)
+			}
+		})
+	}
+}
+
+func TestAddCommentErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		format  string
+		comment string
+		wantErr error
+	}{
+		{"webp", []byte("RIFF"), TYPE_WEBP, "x", ErrUnsupportedFormat},
+		{"jpeg too long", []byte{0xff, 0xd8}, TYPE_JPG, strings.Repeat("x", MaxJPEGCommentSize+1), nil},
+		{"not a jpeg", []byte("GIF89a"), TYPE_JPG, "x", nil},
+		{"not a png", []byte("GIF89a"), TYPE_PNG, "x", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := addComment(tt.data, tt.format, tt.comment)
+			if err == nil {
+				t.Fatal("no error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package resizer
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// ditherImage はimgをFloyd–Steinbergの誤差拡散で量子化した画像を返します。
+// paletteを指定した場合は各画素をpaletteの最も近い色に置き換えた*image.Palettedを、
+// nilの場合は各チャンネルを8bitに落とした*image.RGBAを返します。
+func ditherImage(img image.Image, palette color.Palette) image.Image {
+	b := img.Bounds()
+	w := b.Dx()
+
+	var paletted *image.Paletted
+	var rgba *image.RGBA
+	if palette != nil {
+		paletted = image.NewPaletted(b, palette)
+	} else {
+		rgba = image.NewRGBA(b)
+	}
+
+	// 現在の行と次の行に拡散する誤差(RGBAの4チャンネル、16bitの値)。左右の端の分として1画素ずつ余分に持つ。
+	cur := make([][4]float64, w+2)
+	next := make([][4]float64, w+2)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			i := x - b.Min.X + 1
+			r, g, bl, a := img.At(x, y).RGBA()
+			want := [4]float64{float64(r), float64(g), float64(bl), float64(a)}
+			for ch := range want {
+				want[ch] = math.Max(0, math.Min(0xffff, want[ch]+cur[i][ch]))
+			}
+
+			var got [4]float64
+			if paletted != nil {
+				c := color.RGBA64{uint16(want[0]), uint16(want[1]), uint16(want[2]), uint16(want[3])}
+				idx := palette.Index(c)
+				paletted.SetColorIndex(x, y, uint8(idx))
+				pr, pg, pb, pa := palette[idx].RGBA()
+				got = [4]float64{float64(pr), float64(pg), float64(pb), float64(pa)}
+			} else {
+				var px [4]uint8
+				for ch := range want {
+					px[ch] = uint8(math.Round(want[ch] / 0x101))
+					got[ch] = float64(px[ch]) * 0x101
+				}
+				// 乗算済みの値がアルファを超えないようにそろえる。
+				for ch := 0; ch < 3; ch++ {
+					if px[ch] > px[3] {
+						px[ch] = px[3]
+						got[ch] = float64(px[ch]) * 0x101
+					}
+				}
+				o := rgba.PixOffset(x, y)
+				copy(rgba.Pix[o:o+4], px[:])
+			}
+
+			for ch := range want {
+				e := want[ch] - got[ch]
+				cur[i+1][ch] += e * 7 / 16
+				next[i-1][ch] += e * 3 / 16
+				next[i][ch] += e * 5 / 16
+				next[i+1][ch] += e * 1 / 16
+			}
+		}
+		cur, next = next, cur
+		clear(next)
+	}
+
+	if paletted != nil {
+		return paletted
+	}
+	return rgba
+}
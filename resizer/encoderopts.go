@@ -0,0 +1,91 @@
+package resizer
+
+import (
+	"fmt"
+	"image/png"
+	"maps"
+	"strconv"
+	"strings"
+)
+
+// pngCompressionLevels は-encoderOptsのpng.compressionに指定できる値です。
+var pngCompressionLevels = map[string]png.CompressionLevel{
+	"default": png.DefaultCompression,
+	"none":    png.NoCompression,
+	"speed":   png.BestSpeed,
+	"best":    png.BestCompression,
+}
+
+// encoderOptions は-encoderOptsで指定できるキーと、値をoptに反映する関数です。
+var encoderOptions = map[string]func(value string, opt *Options) error{
+	"jpeg.quality": func(value string, opt *Options) error {
+		return setFormatQuality(TYPE_JPG, value, opt)
+	},
+	"jpeg.chromaSubsampling": func(value string, opt *Options) error {
+		s, err := ParseChromaSubsampling(value)
+		if err != nil {
+			return err
+		}
+		opt.ChromaSubsampling = s
+		return nil
+	},
+	"webp.quality": func(value string, opt *Options) error {
+		return setFormatQuality(TYPE_WEBP, value, opt)
+	},
+	"webp.lossless": func(value string, opt *Options) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		opt.WebPLossless = b
+		return nil
+	},
+	"png.compression": func(value string, opt *Options) error {
+		if _, ok := pngCompressionLevels[value]; !ok {
+			return fmt.Errorf("%q is not one of default, none, speed, best", value)
+		}
+		opt.PNGCompression = value
+		return nil
+	},
+}
+
+// ApplyEncoderOpts は"jpeg.quality=90,png.compression=best,webp.lossless=true"の形式の指定をoptのエンコーダの設定に反映します。
+// 個別のフラグ(quality, webpLossless, chromaSubsampling)で設定した値より優先します。
+// encoderOptionsにないキーや、同じキーを2回指定した場合はエラーにします。
+func ApplyEncoderOpts(s string, opt *Options) error {
+	seen := map[string]bool{}
+	for _, item := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" {
+			return fmt.Errorf("%q is not in key=value form", item)
+		}
+		set, known := encoderOptions[key]
+		if !known {
+			return fmt.Errorf("unknown encoder option %q", key)
+		}
+		if seen[key] {
+			return fmt.Errorf("%s is given twice", key)
+		}
+		seen[key] = true
+		if err := set(value, opt); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// setFormatQuality はformatの品質をvalueにします。opt.FormatQualityは他のOptionsと共有していることがあるため、複製してから変更します。
+func setFormatQuality(format, value string, opt *Options) error {
+	q, err := strconv.Atoi(value)
+	if err != nil || q < 1 || q > 100 {
+		return fmt.Errorf("%q is not an integer between 1 and 100", value)
+	}
+	fq := maps.Clone(opt.FormatQuality)
+	if fq == nil {
+		fq = make(map[string]int)
+	}
+	fq[format] = q
+	opt.FormatQuality = fq
+	return nil
+}
@@ -0,0 +1,38 @@
+package resizer
+
+import "errors"
+
+// ResizeImageが返すエラーの種類です。呼び出し側はerrors.Isで判別できます。
+var (
+	// ErrUnsupportedFormat は入力画像の形式がjpeg, png以外の場合のエラーです。
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	// ErrInvalidImage は入力ファイルが空か、画像として認識できない内容の場合のエラーです。
+	// 画像ではあるが対応していない形式の場合はErrUnsupportedFormatになります。
+	ErrInvalidImage = errors.New("not a valid image")
+	// ErrDecode は画像のデコードに失敗した場合のエラーです。元のエラーもerrors.Is/errors.Asで取り出せます。
+	ErrDecode = errors.New("failed to decode image")
+	// ErrInvalidDimensions はリサイズ後のサイズが決められない場合のエラーです。
+	ErrInvalidDimensions = errors.New("invalid dimensions")
+	// ErrAspectMismatch はStrictAspectが有効で、Width×Heightにすると縦横比が変わってしまう場合のエラーです。
+	ErrAspectMismatch = errors.New("aspect ratio does not match")
+	// ErrOverwriteInput は出力先が入力ファイルと同じで、上書きを中止した場合のエラーです。
+	ErrOverwriteInput = errors.New("refusing to overwrite input file")
+	// ErrOutputNotDir は出力先のディレクトリのパスに、ディレクトリではないファイルがある場合のエラーです。
+	ErrOutputNotDir = errors.New("output directory is not a directory")
+	// ErrTooLarge は入力画像の画素数がMaxPixelsを超えている場合のエラーです。
+	ErrTooLarge = errors.New("image is too large")
+	// ErrIncompatibleColorModel は指定されたカラーモデルが不明か、出力形式で扱えない場合のエラーです。
+	ErrIncompatibleColorModel = errors.New("incompatible color model")
+	// ErrBelowThreshold は入力ファイルがOnlyLargerThanBytes, OnlyWiderThanのいずれも超えていないため、処理しなかった場合のエラーです。
+	ErrBelowThreshold = errors.New("below the size threshold")
+	// ErrOutputTooLarge はMaxOutputBytesが指定されていて、品質と幅・高さを下げても出力がその大きさに収まらなかった場合のエラーです。
+	ErrOutputTooLarge = errors.New("output is too large")
+	// ErrVerifyFailed はVerifyOutputで、書き出したファイルを読み込み直した結果が正しくなかった場合のエラーです。
+	// ファイルは書き出されたまま残ります。
+	ErrVerifyFailed = errors.New("output verification failed")
+	// ErrNotAnimated はFrameStepが指定されていて、入力がアニメーションPNGでないか、アニメーションのまま出力しない場合のエラーです。
+	// GIF, WebPのアニメーションのフレームは間引けません。
+	ErrNotAnimated = errors.New("frameStep needs an animated PNG written as PNG")
+	// ErrSkipped はBatchResizeが途中で中断されたため、処理されなかったファイルのエラーです。
+	ErrSkipped = errors.New("skipped because the batch was aborted")
+)
@@ -0,0 +1,258 @@
+package resizer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// EXIFのタグ番号です。
+const (
+	exifTagOrientation      = 0x0112
+	exifTagExifIFD          = 0x8769
+	exifTagDateTimeOriginal = 0x9003
+)
+
+// exifDateLayout はEXIFの日時の書式です。
+const exifDateLayout = "2006:01:02 15:04:05"
+
+var errNoExif = errors.New("no exif")
+
+// exifInfo はEXIFから読み取った情報です。
+type exifInfo struct {
+	// Orientation は画像の向き(1〜8)です。タグがない場合は0です。
+	Orientation int
+	// DateTimeOriginal は撮影日時です。タグがない場合はゼロ値です。
+	DateTimeOriginal time.Time
+	// Thumbnail はIFD1にJPEGのサムネイルが埋め込まれているかどうかです。
+	Thumbnail bool
+}
+
+// readJPEGExif はJPEGのAPP1セグメントからEXIFのTIFF部分を取り出します。EXIFがない場合はerrNoExifを返します。
+func readJPEGExif(r io.Reader) ([]byte, error) {
+	br := bufio.NewReader(r)
+	var soi [2]byte
+	if _, err := io.ReadFull(br, soi[:]); err != nil {
+		return nil, err
+	}
+	if soi != [2]byte{0xff, 0xd8} {
+		return nil, errors.New("not a jpeg")
+	}
+
+	for {
+		var marker [2]byte
+		if _, err := io.ReadFull(br, marker[:]); err != nil {
+			return nil, err
+		}
+		if marker[0] != 0xff {
+			return nil, errors.New("invalid jpeg marker")
+		}
+		// SOSより後は画像データなので、EXIFは見つからなかったことになる。
+		if marker[1] == 0xda || marker[1] == 0xd9 {
+			return nil, errNoExif
+		}
+
+		var size uint16
+		if err := binary.Read(br, binary.BigEndian, &size); err != nil {
+			return nil, err
+		}
+		if size < 2 {
+			return nil, errors.New("invalid jpeg segment size")
+		}
+		data := make([]byte, size-2)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return nil, err
+		}
+		if marker[1] == 0xe1 && bytes.HasPrefix(data, []byte("Exif\x00\x00")) {
+			return data[6:], nil
+		}
+	}
+}
+
+// pngSignature はPNGファイルの先頭8バイトです。
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// maxExifChunkSize はPNGのeXIfチャンクとして読み込むデータの上限です。
+const maxExifChunkSize = 1 << 20
+
+// readPNGExif はPNGのeXIfチャンクからEXIFのTIFF部分を取り出します。eXIfチャンクがない場合はerrNoExifを返します。
+// eXIfチャンクはIDATの後に置かれることもあるため、IENDまで探します。
+func readPNGExif(r io.Reader) ([]byte, error) {
+	br := bufio.NewReader(r)
+	var sig [8]byte
+	if _, err := io.ReadFull(br, sig[:]); err != nil {
+		return nil, err
+	}
+	if string(sig[:]) != pngSignature {
+		return nil, errors.New("not a png")
+	}
+
+	for {
+		// チャンクは長さ(4バイト)、種類(4バイト)、データ、CRC(4バイト)の順に並ぶ。
+		var header [8]byte
+		if _, err := io.ReadFull(br, header[:]); err != nil {
+			return nil, err
+		}
+		size := binary.BigEndian.Uint32(header[:4])
+		switch string(header[4:]) {
+		case "IEND":
+			return nil, errNoExif
+		case "eXIf":
+			if size > maxExifChunkSize {
+				return nil, errors.New("png exif chunk is too large")
+			}
+			data := make([]byte, size)
+			if _, err := io.ReadFull(br, data); err != nil {
+				return nil, err
+			}
+			return data, nil
+		}
+		if _, err := br.Discard(int(size) + 4); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseExif はEXIFのTIFF部分から向きと撮影日時、サムネイルの有無を読み取ります。
+// 壊れたEXIFはよくあるため、IFD0が読めれば、範囲外を指すExif IFDや値が不正なタグはないものとして扱います。
+func parseExif(tiff []byte) (*exifInfo, error) {
+	if len(tiff) < 8 {
+		return nil, errors.New("exif is too short")
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("invalid exif byte order")
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return nil, errors.New("invalid tiff header")
+	}
+
+	info := &exifInfo{}
+	ifd0Offset := order.Uint32(tiff[4:])
+	ifd0, err := readIFD(tiff, order, ifd0Offset)
+	if err != nil {
+		return nil, err
+	}
+	// IFD0のエントリの後ろにあるIFD1のオフセットをたどる。
+	if next := int(ifd0Offset) + 2 + int(order.Uint16(tiff[ifd0Offset:]))*12; next+4 <= len(tiff) {
+		if off := order.Uint32(tiff[next:]); off != 0 {
+			if ifd1, err := readIFD(tiff, order, off); err == nil {
+				_, info.Thumbnail = ifd1[exifTagJPEGInterchangeFormat]
+			}
+		}
+	}
+	if e, ok := ifd0[exifTagOrientation]; ok {
+		if o := e.short(order); o >= 1 && o <= 8 {
+			info.Orientation = o
+		}
+	}
+	if e, ok := ifd0[exifTagExifIFD]; ok {
+		exifIFD, err := readIFD(tiff, order, order.Uint32(e.value))
+		if err != nil {
+			return info, nil
+		}
+		if e, ok := exifIFD[exifTagDateTimeOriginal]; ok {
+			if s, ok := e.ascii(tiff, order); ok {
+				if t, err := time.Parse(exifDateLayout, s); err == nil {
+					info.DateTimeOriginal = t
+				}
+			}
+		}
+	}
+	return info, nil
+}
+
+// ifdEntry はIFDの1エントリです。valueは値またはオフセットの4バイトです。
+type ifdEntry struct {
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// short はSHORT型のエントリの値を返します。LONG型で書かれている場合はその値を返します。
+func (e ifdEntry) short(order binary.ByteOrder) int {
+	if e.typ == 4 {
+		return int(order.Uint32(e.value))
+	}
+	return int(order.Uint16(e.value))
+}
+
+// ascii はASCII型のエントリの文字列を末尾のNULを除いて返します。
+func (e ifdEntry) ascii(tiff []byte, order binary.ByteOrder) (string, bool) {
+	if e.typ != 2 || e.count == 0 {
+		return "", false
+	}
+	data := e.value
+	if e.count > 4 {
+		off := order.Uint32(e.value)
+		if uint64(off)+uint64(e.count) > uint64(len(tiff)) {
+			return "", false
+		}
+		data = tiff[off : off+e.count]
+	} else {
+		data = data[:e.count]
+	}
+	return string(bytes.TrimRight(data, "\x00")), true
+}
+
+// readIFD はoffsetの位置のIFDをタグ番号ごとに読み取ります。
+func readIFD(tiff []byte, order binary.ByteOrder, offset uint32) (map[uint16]ifdEntry, error) {
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return nil, errors.New("ifd offset out of range")
+	}
+	n := int(order.Uint16(tiff[offset:]))
+	start := int(offset) + 2
+	if start+n*12 > len(tiff) {
+		return nil, errors.New("ifd entries out of range")
+	}
+	entries := make(map[uint16]ifdEntry, n)
+	for i := 0; i < n; i++ {
+		b := tiff[start+i*12 : start+(i+1)*12]
+		entries[order.Uint16(b)] = ifdEntry{
+			typ:   order.Uint16(b[2:]),
+			count: order.Uint32(b[4:]),
+			value: b[8:12],
+		}
+	}
+	return entries, nil
+}
+
+// readExifFile はformat形式の画像ファイルのEXIFを読み取ります。JPEG, PNG以外の場合はerrNoExifを返します。
+// 想定していない壊れ方をしたEXIFでバッチ全体が止まらないよう、読み取り中のpanicはエラーとして返します。
+func readExifFile(path, format string) (info *exifInfo, err error) {
+	var readExif func(io.Reader) ([]byte, error)
+	switch format {
+	case TYPE_JPG:
+		readExif = readJPEGExif
+	case TYPE_PNG:
+		readExif = readPNGExif
+	default:
+		return nil, errNoExif
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	defer func() {
+		if r := recover(); r != nil {
+			info, err = nil, fmt.Errorf("malformed exif: %v", r)
+		}
+	}()
+	tiff, err := readExif(f)
+	if err != nil {
+		return nil, err
+	}
+	return parseExif(tiff)
+}
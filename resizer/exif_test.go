@@ -0,0 +1,146 @@
+package resizer
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// exifIFDOffset, exifDateOffset はbuildTIFFが書き出すTIFFの中の、Exif IFDとDateTimeOriginalの文字列の位置です。
+const (
+	exifIFDOffset  = 8 + 2 + 2*12 + 4
+	exifDateOffset = exifIFDOffset + 2 + 12 + 4
+)
+
+// buildTIFF は向きorientationのIFD0と、撮影日時dateのExif IFDを持つビッグエンディアンのTIFFを返します。
+func buildTIFF(orientation uint16, date string) []byte {
+	be := binary.BigEndian
+	b := []byte{'M', 'M', 0, 42, 0, 0, 0, 8}
+	entry := func(tag, typ uint16, count, value uint32) {
+		b = be.AppendUint16(b, tag)
+		b = be.AppendUint16(b, typ)
+		b = be.AppendUint32(b, count)
+		b = be.AppendUint32(b, value)
+	}
+	b = be.AppendUint16(b, 2)
+	entry(exifTagOrientation, 3, 1, uint32(orientation)<<16)
+	entry(exifTagExifIFD, 4, 1, exifIFDOffset)
+	b = be.AppendUint32(b, 0)
+	b = be.AppendUint16(b, 1)
+	entry(exifTagDateTimeOriginal, 2, uint32(len(date)+1), exifDateOffset)
+	b = be.AppendUint32(b, 0)
+	b = append(b, date...)
+	return append(b, 0)
+}
+
+// withJPEGExif はJPEGのjpgのSOIの直後に、tiffを入れたAPP1セグメントを入れたものを返します。
+func withJPEGExif(jpg, tiff []byte) []byte {
+	seg := append([]byte("Exif\x00\x00"), tiff...)
+	out := []byte{0xff, 0xd8, 0xff, 0xe1}
+	out = binary.BigEndian.AppendUint16(out, uint16(len(seg)+2))
+	out = append(out, seg...)
+	return append(out, jpg[2:]...)
+}
+
+// corruptTIFF はbuildTIFFのTIFFのoffsetから4バイトをvで書き換えたものを返します。
+func corruptTIFF(offset int, v uint32) []byte {
+	tiff := buildTIFF(6, "2024:05:01 10:00:00")
+	binary.BigEndian.PutUint32(tiff[offset:], v)
+	return tiff
+}
+
+func TestParseCorruptExif(t *testing.T) {
+	date := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name            string
+		tiff            []byte
+		wantErr         bool
+		wantOrientation int
+		wantDate        time.Time
+	}{
+		{"valid", buildTIFF(6, "2024:05:01 10:00:00"), false, 6, date},
+		{"exif ifd out of range", corruptTIFF(8+2+12+8, 0xffff), false, 6, time.Time{}},
+		{"date out of range", corruptTIFF(exifIFDOffset+2+8, 0xffffffff), false, 6, time.Time{}},
+		{"invalid date", buildTIFF(6, "0000:00:00 00:00:00"), false, 6, time.Time{}},
+		{"invalid orientation", buildTIFF(9, "2024:05:01 10:00:00"), false, 0, date},
+		{"ifd0 out of range", corruptTIFF(4, 0xfffffff0), true, 0, time.Time{}},
+		{"truncated", buildTIFF(6, "2024:05:01 10:00:00")[:20], true, 0, time.Time{}},
+		{"bad byte order", append([]byte("XX"), buildTIFF(6, "")[2:]...), true, 0, time.Time{}},
+		{"empty", nil, true, 0, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := parseExif(tt.tiff)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if info.Orientation != tt.wantOrientation || !info.DateTimeOriginal.Equal(tt.wantDate) {
+				t.Errorf("orientation %d, date %v, want %d, %v", info.Orientation, info.DateTimeOriginal, tt.wantOrientation, tt.wantDate)
+			}
+		})
+	}
+}
+
+func TestCorruptExifDoesNotFailBatch(t *testing.T) {
+	dir := t.TempDir()
+	raw, err := os.ReadFile(writeJPEG(t, dir, "plain.jpg", gradient(40, 30)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2020, 3, 15, 12, 0, 0, 0, time.Local)
+	files := []struct {
+		name string
+		tiff []byte
+		// wantHeight は向きを反映して幅20pxにした高さです。30x40に回転した場合は27pxになります。
+		wantHeight        int
+		wantDir, fallback string
+	}{
+		{"valid.jpg", buildTIFF(6, "2024:05:01 10:00:00"), 27, "2024/05", "2024/05"},
+		{"truncated.jpg", buildTIFF(6, "2024:05:01 10:00:00")[:20], 15, "unknown", "2020/03"},
+		{"bad-exif-ifd.jpg", corruptTIFF(8+2+12+8, 0xffff), 27, "unknown", "2020/03"},
+		{"bad-date.jpg", buildTIFF(6, "0000:00:00 00:00:00"), 27, "unknown", "2020/03"},
+		{"bad-ifd0.jpg", corruptTIFF(4, 0xfffffff0), 15, "unknown", "2020/03"},
+	}
+	var inputs []string
+	for _, f := range files {
+		p := filepath.Join(dir, f.name)
+		if err := os.WriteFile(p, withJPEGExif(raw, f.tiff), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, p)
+	}
+
+	for _, mode := range []struct {
+		name       string
+		noFallback bool
+	}{{"nofallback", true}, {"fallback", false}} {
+		noFallback := mode.noFallback
+		out := filepath.Join(dir, "out", mode.name)
+		results := BatchResize(inputs, Options{Width: 20, OutputDir: out, AutoOrient: true, OrganizeByDate: true, NoMetadataDateFallback: noFallback, FailFast: true})
+		for i, r := range results {
+			f := files[i]
+			if r.Err != nil {
+				t.Errorf("%s: %v", f.name, r.Err)
+				continue
+			}
+			want := f.fallback
+			if noFallback {
+				want = f.wantDir
+			}
+			if got := filepath.Dir(r.OutputPath); got != filepath.Join(out, filepath.FromSlash(want)) {
+				t.Errorf("%s (noMetadataDateFallback=%v) is written to %s, want %s", f.name, noFallback, got, want)
+			}
+			if r.Height != f.wantHeight {
+				t.Errorf("%s: height %d, want %d", f.name, r.Height, f.wantHeight)
+			}
+		}
+	}
+}
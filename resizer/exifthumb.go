@@ -0,0 +1,100 @@
+package resizer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/jpeg"
+
+	"golang.org/x/image/draw"
+)
+
+// EXIFのサムネイル(IFD1)に使うタグ番号です。
+const (
+	exifTagCompression           = 0x0103
+	exifTagXResolution           = 0x011a
+	exifTagYResolution           = 0x011b
+	exifTagResolutionUnit        = 0x0128
+	exifTagJPEGInterchangeFormat = 0x0201
+	exifTagJPEGInterchangeLength = 0x0202
+)
+
+// exifThumbnailSize はExifThumbnailで作り直すサムネイルの長辺の最大の大きさです。EXIFの標準の160×120に合わせています。
+const exifThumbnailSize = 160
+
+// exifThumbnailQuality はサムネイルをJPEGにするときの品質です。
+const exifThumbnailQuality = 75
+
+// addExifThumbnail はエンコード済みのJPEGのdataに、imgから作ったサムネイルだけを持つEXIFのAPP1セグメントをSOIの直後に入れたものを返します。
+// 入力のEXIFはコピーしないため、IFD0には向き(1: 回転なし)だけを書きます。
+func addExifThumbnail(data []byte, img image.Image) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil, errors.New("not a jpeg")
+	}
+	var thumb bytes.Buffer
+	if err := jpeg.Encode(&thumb, exifThumbnail(img), &jpeg.Options{Quality: exifThumbnailQuality}); err != nil {
+		return nil, err
+	}
+
+	// TIFFヘッダ(8)、IFD0(エントリ1つ、18)、IFD1(エントリ6つ、78)、解像度の有理数(8)、サムネイルの順に並べる。
+	const ifd0, ifd1, rational, thumbOffset = 8, 26, 104, 112
+	order := binary.LittleEndian
+	tiff := make([]byte, thumbOffset, thumbOffset+thumb.Len())
+	copy(tiff, "II")
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], ifd0)
+	putIFD := func(offset int, next uint32, entries [][4]uint32) {
+		order.PutUint16(tiff[offset:], uint16(len(entries)))
+		for i, e := range entries {
+			b := tiff[offset+2+i*12:]
+			order.PutUint16(b, uint16(e[0]))
+			order.PutUint16(b[2:], uint16(e[1]))
+			order.PutUint32(b[4:], e[2])
+			if e[1] == 3 {
+				order.PutUint16(b[8:], uint16(e[3]))
+			} else {
+				order.PutUint32(b[8:], e[3])
+			}
+		}
+		order.PutUint32(tiff[offset+2+len(entries)*12:], next)
+	}
+	// エントリはタグ番号、型(3: SHORT, 4: LONG, 5: RATIONAL)、個数、値またはオフセットの順。
+	putIFD(ifd0, ifd1, [][4]uint32{
+		{exifTagOrientation, 3, 1, 1},
+	})
+	putIFD(ifd1, 0, [][4]uint32{
+		{exifTagCompression, 3, 1, 6},
+		{exifTagXResolution, 5, 1, rational},
+		{exifTagYResolution, 5, 1, rational},
+		{exifTagResolutionUnit, 3, 1, 2},
+		{exifTagJPEGInterchangeFormat, 4, 1, thumbOffset},
+		{exifTagJPEGInterchangeLength, 4, 1, uint32(thumb.Len())},
+	})
+	order.PutUint32(tiff[rational:], 72)
+	order.PutUint32(tiff[rational+4:], 1)
+	tiff = append(tiff, thumb.Bytes()...)
+
+	const header = "Exif\x00\x00"
+	if 2+len(header)+len(tiff) > 0xffff {
+		return nil, errors.New("exif thumbnail is too large")
+	}
+	var seg bytes.Buffer
+	seg.Write([]byte{0xff, 0xe1})
+	binary.Write(&seg, binary.BigEndian, uint16(2+len(header)+len(tiff)))
+	seg.WriteString(header)
+	seg.Write(tiff)
+	return insertBytes(data, 2, seg.Bytes()), nil
+}
+
+// exifThumbnail はimgを縦横比を保って長辺exifThumbnailSize以下に縮小した画像を返します。imgがそれより小さい場合は拡大しません。
+func exifThumbnail(img image.Image) image.Image {
+	b := img.Bounds()
+	if b.Dx() <= exifThumbnailSize && b.Dy() <= exifThumbnailSize {
+		return img
+	}
+	fit := fitRect(b, image.Rect(0, 0, exifThumbnailSize, exifThumbnailSize))
+	dst := image.NewRGBA(fit.Sub(fit.Min))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
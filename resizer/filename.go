@@ -0,0 +1,58 @@
+package resizer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// windowsReservedChars はWindowsのファイル名に使えない文字です(パス区切りの\を除く)。
+const windowsReservedChars = `<>:"|?*`
+
+// windowsReservedNames はWindowsで拡張子があっても使えないファイル名です。COM1〜9, LPT1〜9はisWindowsReservedNameで判定します。
+var windowsReservedNames = map[string]bool{"CON": true, "PRN": true, "AUX": true, "NUL": true}
+
+// CheckNamePart はsuffixなど、出力ファイル名の一部として付ける文字列sがファイル名として使えるかを確認します。
+// パス区切り(/, \)と制御文字、Windowsのファイル名に使えない文字を含む場合はエラーにします。
+func CheckNamePart(s string) error {
+	if strings.ContainsAny(s, `/\`) {
+		return fmt.Errorf("%q contains a path separator", s)
+	}
+	for _, c := range s {
+		if c < 0x20 || c == 0x7f {
+			return fmt.Errorf("%q contains a control character", s)
+		}
+	}
+	if i := strings.IndexAny(s, windowsReservedChars); i >= 0 {
+		return fmt.Errorf("%q contains %q, which cannot be used in file names on Windows", s, s[i])
+	}
+	return nil
+}
+
+// SanitizeNamePart はsに含まれるWindowsで使えない文字を_に置き換えます。パス区切りと制御文字はそのまま残し、CheckNamePartでエラーにします。
+func SanitizeNamePart(s string) string {
+	return strings.Map(func(c rune) rune {
+		if strings.ContainsRune(windowsReservedChars, c) {
+			return '_'
+		}
+		return c
+	}, s)
+}
+
+// isWindowsReservedName はファイル名nameが、Windowsで拡張子に関係なく予約されている名前(CON, NUL, COM1など)かどうかを返します。
+func isWindowsReservedName(name string) bool {
+	stem, _, _ := strings.Cut(name, ".")
+	stem = strings.ToUpper(strings.TrimRight(stem, " "))
+	if windowsReservedNames[stem] {
+		return true
+	}
+	return len(stem) == 4 && (strings.HasPrefix(stem, "COM") || strings.HasPrefix(stem, "LPT")) && stem[3] >= '1' && stem[3] <= '9'
+}
+
+// dimensionSuffix は出力する画像の幅・高さを表す"-幅x高さ"の接尾辞を返します。
+// w, hはリサイズ後のサイズで、opt.Pow2が有効な場合は余白を付けた後のサイズにします。
+func dimensionSuffix(w, h int, opt Options) string {
+	if opt.Pow2 {
+		w, h = nextPow2(w), nextPow2(h)
+	}
+	return fmt.Sprintf("-%dx%d", w, h)
+}
@@ -0,0 +1,35 @@
+package resizer
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDimSuffixUsesComputedSize(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  Options
+		want string
+	}{
+		{"height only", Options{Height: 300}, "a-400x300.jpg"},
+		{"height only with -1 width", Options{Width: SIZE_AUTO, Height: 225}, "a-300x225.jpg"},
+		{"width only rounds", Options{Width: 250}, "a-250x188.jpg"},
+		{"fit in box", Options{Width: 200, Height: 200, KeepAspectRatio: true}, "a-200x150.jpg"},
+		{"with suffix", Options{Height: 300, Suffix: "_s"}, "a_s-400x300.jpg"},
+		{"pow2 canvas", Options{Width: 300, Pow2: true}, "a-512x256.jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := writeJPEG(t, dir, "a.jpg", gradient(800, 600))
+			tt.opt.DimSuffix, tt.opt.OutputDir = true, filepath.Join(dir, "out")
+			r, err := ResizeImage(src, tt.opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := filepath.Base(r.OutputPath); got != tt.want {
+				t.Errorf("output name = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
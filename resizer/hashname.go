@@ -0,0 +1,15 @@
+package resizer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// hashNameLength はHashNameで使うハッシュの16進数の文字数です。
+const hashNameLength = 16
+
+// contentHashName はdataのSHA-256を16進数にした先頭hashNameLength文字を返します。
+func contentHashName(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:hashNameLength]
+}
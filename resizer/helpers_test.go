@@ -0,0 +1,90 @@
+package resizer
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "golang.org/x/image/webp"
+)
+
+// gradient は色が位置によって変わる、不透明なw×hの画像を返します。
+func gradient(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x * 255 / max(w-1, 1)), uint8(y * 255 / max(h-1, 1)), 100, 255})
+		}
+	}
+	return img
+}
+
+// writePNG はimgをdirのnameにPNGで書き出し、そのパスを返します。
+func writePNG(t testing.TB, dir, name string, img image.Image) string {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// writeJPEG はimgをdirのnameにJPEG(品質95)で書き出し、そのパスを返します。
+func writeJPEG(t testing.TB, dir, name string, img image.Image) string {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := jpeg.Encode(f, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// decodeFile はpathの画像をデコードして、画像と形式を返します。
+func decodeFile(t testing.TB, path string) (image.Image, string) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, format, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("decode %s: %v", path, err)
+	}
+	return img, format
+}
+
+// pngChunks はPNGのdataのチャンクを、IENDまでファイル内の順番に返します。
+func pngChunks(t testing.TB, data []byte) []pngChunk {
+	t.Helper()
+	if len(data) < 8 || string(data[:8]) != pngSignature {
+		t.Fatal("not a png")
+	}
+	r := bytes.NewReader(data[8:])
+	var chunks []pngChunk
+	for {
+		c, err := readPNGChunk(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, c)
+		if c.typ == "IEND" {
+			return chunks
+		}
+	}
+}
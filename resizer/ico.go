@@ -0,0 +1,84 @@
+package resizer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/draw"
+)
+
+// ICOSizes は-icoで.icoファイルに含める画像の一辺のサイズです。
+var ICOSizes = []int{16, 32, 48}
+
+// icoImages はsrcのrctの範囲をICOSizesの各サイズの正方形に縦横比を保って収めた画像を返します。余白は透過になります。
+func icoImages(src image.Image, rct image.Rectangle, opt Options) []image.Image {
+	images := make([]image.Image, 0, len(ICOSizes))
+	for _, size := range ICOSizes {
+		w, h := size, size
+		if rct.Dx() > rct.Dy() {
+			h = max(1, rct.Dy()*size/rct.Dx())
+		} else {
+			w = max(1, rct.Dx()*size/rct.Dy())
+		}
+		x0, y0 := (size-w)/2, (size-h)/2
+
+		img := image.NewRGBA(image.Rect(0, 0, size, size))
+		scalerFor(opt).Scale(img, image.Rect(x0, y0, x0+w, y0+h), src, rct, draw.Over, nil)
+		finishImage(img, opt)
+		images = append(images, img)
+	}
+	return images
+}
+
+// writeICO は画像をPNG形式のエントリとして格納したICOファイルをwに書き出します。
+// 各画像の一辺は256px以下である必要があります。
+//
+// ICOファイルは6バイトのヘッダ(ICONDIR)、画像ごとの16バイトのエントリ(ICONDIRENTRY)、画像データの順に並びます。
+func writeICO(w io.Writer, images []image.Image) error {
+	data := make([][]byte, len(images))
+	for i, img := range images {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return err
+		}
+		data[i] = buf.Bytes()
+	}
+
+	// ICONDIR: 予約(0), 種類(1=アイコン), 画像数
+	header := []uint16{0, 1, uint16(len(images))}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+
+	offset := 6 + 16*len(images)
+	for i, img := range images {
+		b := img.Bounds()
+		entry := struct {
+			Width, Height, ColorCount, Reserved uint8
+			Planes, BitCount                    uint16
+			BytesInRes, ImageOffset             uint32
+		}{
+			// 256pxは0で表す。
+			Width:       uint8(b.Dx()),
+			Height:      uint8(b.Dy()),
+			Planes:      1,
+			BitCount:    32,
+			BytesInRes:  uint32(len(data[i])),
+			ImageOffset: uint32(offset),
+		}
+		if err := binary.Write(w, binary.LittleEndian, entry); err != nil {
+			return err
+		}
+		offset += len(data[i])
+	}
+
+	for _, d := range data {
+		if _, err := w.Write(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package resizer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestICODirectoryEntries(t *testing.T) {
+	tests := []struct {
+		name string
+		w, h int
+	}{
+		{"landscape", 300, 200},
+		{"portrait", 200, 300},
+		{"square", 64, 64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := writeJPEG(t, dir, "a.jpg", gradient(tt.w, tt.h))
+			out := filepath.Join(dir, "out")
+			if _, err := ResizeImage(src, Options{ICO: true, OutputDir: out}); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(filepath.Join(out, "a.ico"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var header struct{ Reserved, Type, Count uint16 }
+			if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &header); err != nil {
+				t.Fatal(err)
+			}
+			if header.Reserved != 0 || header.Type != 1 || int(header.Count) != len(ICOSizes) {
+				t.Fatalf("header = %+v, want type 1 with %d images", header, len(ICOSizes))
+			}
+			for i, size := range ICOSizes {
+				e := data[6+16*i : 6+16*(i+1)]
+				if int(e[0]) != size || int(e[1]) != size {
+					t.Errorf("entry %d is %dx%d, want %dx%d", i, e[0], e[1], size, size)
+				}
+				n := binary.LittleEndian.Uint32(e[8:])
+				off := binary.LittleEndian.Uint32(e[12:])
+				if int(off)+int(n) > len(data) {
+					t.Fatalf("entry %d data %d+%d is beyond the %d-byte file", i, off, n, len(data))
+				}
+				img, err := png.Decode(bytes.NewReader(data[off : off+n]))
+				if err != nil {
+					t.Fatalf("entry %d: %v", i, err)
+				}
+				if img.Bounds() != image.Rect(0, 0, size, size) {
+					t.Errorf("entry %d image is %v, want %dx%d", i, img.Bounds(), size, size)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteICO256(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeICO(&buf, []image.Image{image.NewRGBA(image.Rect(0, 0, 256, 256))}); err != nil {
+		t.Fatal(err)
+	}
+	if e := buf.Bytes()[6:]; e[0] != 0 || e[1] != 0 {
+		t.Errorf("256px entry is stored as %dx%d, want 0x0", e[0], e[1])
+	}
+}
@@ -0,0 +1,79 @@
+package resizer
+
+import (
+	"context"
+	"fmt"
+	"image/color"
+)
+
+// Inspection は-inspectで表示する1ファイル分の情報です。
+type Inspection struct {
+	SourcePath   string `json:"sourcePath"`
+	SourceWidth  int    `json:"sourceWidth"`
+	SourceHeight int    `json:"sourceHeight"`
+	Format       string `json:"format"`
+	ColorModel   string `json:"colorModel"`
+	HasAlpha     bool   `json:"hasAlpha"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+}
+
+// String は"元のサイズ 形式 カラーモデル alpha=有無 -> 変換後のサイズ"の形式で返します。
+func (in *Inspection) String() string {
+	return fmt.Sprintf("%dx%d %s %s alpha=%t -> %dx%d", in.SourceWidth, in.SourceHeight, in.Format, in.ColorModel, in.HasAlpha, in.Width, in.Height)
+}
+
+// InspectImage はsrcPathの画像を読み込み、元のサイズ・形式・カラーモデル・透過の有無と、
+// optでリサイズした場合のサイズを返します。ファイルは書き出しません。
+func InspectImage(srcPath string, opt Options) (*Inspection, error) {
+	img, cfg, t, err := decodeImage(context.Background(), srcPath, opt)
+	if err != nil {
+		return nil, err
+	}
+	newW, newH, _, err := targetSize(sourceRect(autoOrient(img, srcPath, t, opt), opt), opt)
+	if err != nil {
+		return nil, err
+	}
+	return &Inspection{
+		SourcePath:   srcPath,
+		SourceWidth:  cfg.Width,
+		SourceHeight: cfg.Height,
+		Format:       t,
+		ColorModel:   colorModelName(cfg.ColorModel),
+		HasAlpha:     !isOpaque(img),
+		Width:        newW,
+		Height:       newH,
+	}, nil
+}
+
+// colorModelName はカラーモデルの表示用の名前を返します。
+func colorModelName(m color.Model) string {
+	switch m {
+	case color.RGBAModel:
+		return "RGBA"
+	case color.RGBA64Model:
+		return "RGBA64"
+	case color.NRGBAModel:
+		return "NRGBA"
+	case color.NRGBA64Model:
+		return "NRGBA64"
+	case color.AlphaModel:
+		return "Alpha"
+	case color.Alpha16Model:
+		return "Alpha16"
+	case color.GrayModel:
+		return "Gray"
+	case color.Gray16Model:
+		return "Gray16"
+	case color.YCbCrModel:
+		return "YCbCr"
+	case color.NYCbCrAModel:
+		return "NYCbCrA"
+	case color.CMYKModel:
+		return "CMYK"
+	}
+	if p, ok := m.(color.Palette); ok {
+		return fmt.Sprintf("Paletted(%d colors)", len(p))
+	}
+	return fmt.Sprintf("%T", m)
+}
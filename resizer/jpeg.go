@@ -0,0 +1,28 @@
+package resizer
+
+import (
+	"fmt"
+	"image"
+)
+
+// DefaultChromaSubsampling は標準ライブラリのjpegエンコーダと同じ色差サブサンプリングです。
+const DefaultChromaSubsampling = "420"
+
+// chromaSubsamplingRatios は-chromaSubsamplingで指定できる値です。
+var chromaSubsamplingRatios = map[string]image.YCbCrSubsampleRatio{
+	"444": image.YCbCrSubsampleRatio444,
+	"440": image.YCbCrSubsampleRatio440,
+	"422": image.YCbCrSubsampleRatio422,
+	"420": image.YCbCrSubsampleRatio420,
+}
+
+// ParseChromaSubsampling は"444"などの指定を検証して返します。空文字は既定値として扱います。
+func ParseChromaSubsampling(s string) (string, error) {
+	if s == "" {
+		return DefaultChromaSubsampling, nil
+	}
+	if _, ok := chromaSubsamplingRatios[s]; !ok {
+		return "", fmt.Errorf("%q is not one of 444, 440, 422, 420", s)
+	}
+	return s, nil
+}
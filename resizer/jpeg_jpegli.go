@@ -0,0 +1,28 @@
+//go:build jpegli
+
+package resizer
+
+import (
+	"image"
+	"image/jpeg"
+	"io"
+
+	"github.com/gen2brain/jpegli"
+)
+
+// ChromaSubsamplingSupported はDefaultChromaSubsampling以外の色差サブサンプリングを出力できるかどうかです。
+const ChromaSubsamplingSupported = true
+
+// encodeJPEG はJPEGを書き出します。既定の4:2:0ではこれまでと同じ出力になるよう標準ライブラリを使い、
+// それ以外の指定の場合のみjpegliでエンコードします。
+func encodeJPEG(w io.Writer, img image.Image, quality int, subsampling string) error {
+	if subsampling == "" || subsampling == DefaultChromaSubsampling {
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	}
+	return jpegli.Encode(w, img, &jpegli.EncodingOptions{
+		Quality:              quality,
+		ChromaSubsampling:    chromaSubsamplingRatios[subsampling],
+		OptimizeCoding:       true,
+		AdaptiveQuantization: true,
+	})
+}
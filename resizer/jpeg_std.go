@@ -0,0 +1,18 @@
+//go:build !jpegli
+
+package resizer
+
+import (
+	"image"
+	"image/jpeg"
+	"io"
+)
+
+// ChromaSubsamplingSupported はDefaultChromaSubsampling以外の色差サブサンプリングを出力できるかどうかです。
+// 標準ライブラリのエンコーダは4:2:0固定のため、jpegliタグ付きでビルドした場合のみ有効になります。
+const ChromaSubsamplingSupported = false
+
+// encodeJPEG は標準ライブラリでJPEGを書き出します。subsamplingは無視され、常に4:2:0になります。
+func encodeJPEG(w io.Writer, img image.Image, quality int, subsampling string) error {
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+}
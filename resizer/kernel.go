@@ -0,0 +1,105 @@
+package resizer
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// MinKernelRadius, MaxKernelRadius は-kernelRadiusで指定できるカーネルの半径(入力画素単位)の範囲です。
+const (
+	MinKernelRadius = 1.0
+	MaxKernelRadius = 8.0
+)
+
+// kernelFuncs は-kernelで選べるカーネルです。radiusが0の場合に使う既定の半径と、
+// 半径rのときの距離t(0 <= t < r)における重みを返す関数を持ちます。
+var kernelFuncs = map[string]struct {
+	radius float64
+	at     func(t, r float64) float64
+}{
+	"lanczos":  {3, lanczos},
+	"triangle": {1, func(t, r float64) float64 { return 1 - t/r }},
+	"gaussian": {2, func(t, r float64) float64 {
+		// 半径を3σとし、端の重みがほぼ0になるようにする。
+		sigma := r / 3
+		return math.Exp(-t * t / (2 * sigma * sigma))
+	}},
+}
+
+// interpolations は-interpolationで選べる補間方法です。lanczos2, lanczos3はそれぞれ半径2, 3のLanczos窓関数です。
+var interpolations = map[string]draw.Scaler{
+	"nearest":    draw.NearestNeighbor,
+	"bilinear":   draw.BiLinear,
+	"catmullrom": draw.CatmullRom,
+	"lanczos2":   lanczosKernel(2),
+	"lanczos3":   lanczosKernel(3),
+}
+
+// lanczosKernel は半径aのLanczos窓関数のdraw.Kernelを返します。
+func lanczosKernel(a float64) *draw.Kernel {
+	return &draw.Kernel{Support: a, At: func(t float64) float64 { return lanczos(t, a) }}
+}
+
+// lanczos は半径aのLanczos窓関数(窓付きsinc関数)の距離tにおける値を返します。
+func lanczos(t, a float64) float64 {
+	if t == 0 {
+		return 1
+	}
+	x := math.Pi * t
+	return a * math.Sin(x) * math.Sin(x/a) / (x * x)
+}
+
+// NewKernel はnameのカーネル関数を半径radiusで使うdraw.Kernelを返します。
+// radiusが0の場合はカーネルごとの既定の半径を使います。
+func NewKernel(name string, radius float64) (*draw.Kernel, error) {
+	k, ok := kernelFuncs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown kernel %q (available: %s)", name, strings.Join(kernelNames(), ", "))
+	}
+	if radius == 0 {
+		radius = k.radius
+	}
+	if math.IsNaN(radius) || radius < MinKernelRadius || radius > MaxKernelRadius {
+		return nil, fmt.Errorf("kernel radius must be between %g and %g: %g", MinKernelRadius, MaxKernelRadius, radius)
+	}
+	return &draw.Kernel{
+		Support: radius,
+		At:      func(t float64) float64 { return k.at(t, radius) },
+	}, nil
+}
+
+// NewInterpolation はnameの補間方法を返します。
+func NewInterpolation(name string) (draw.Scaler, error) {
+	s, ok := interpolations[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown interpolation %q (available: %s)", name, strings.Join(sortedKeys(interpolations), ", "))
+	}
+	return s, nil
+}
+
+// kernelNames は-kernelで選べるカーネルの名前を昇順で返します。
+func kernelNames() []string {
+	return sortedKeys(kernelFuncs)
+}
+
+// sortedKeys はmのキーを昇順で返します。
+func sortedKeys[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// scalerFor はoptで縮小に使うdraw.Scalerを返します。Scalerが未指定の場合はCatmull-Romを使います。
+func scalerFor(opt Options) draw.Scaler {
+	if opt.Scaler != nil {
+		return opt.Scaler
+	}
+	return draw.CatmullRom
+}
@@ -0,0 +1,45 @@
+package resizer
+
+import (
+	"image"
+	"math"
+	"testing"
+
+	"golang.org/x/image/draw"
+)
+
+func TestLanczos(t *testing.T) {
+	tests := []struct {
+		t, a, want float64
+	}{
+		{0, 3, 1},
+		{1, 3, 0},
+		{2, 3, 0},
+		{-1, 2, 0},
+		{0.5, 3, 0.6079271},
+		{0.5, 2, 0.5731591},
+		{1.5, 3, -0.1350949},
+	}
+	for _, tt := range tests {
+		if got := lanczos(tt.t, tt.a); math.Abs(got-tt.want) > 1e-6 {
+			t.Errorf("lanczos(%g, %g) = %g, want %g", tt.t, tt.a, got, tt.want)
+		}
+	}
+}
+
+func BenchmarkScale(b *testing.B) {
+	src := fullColor(noisy(2000, 1500))
+	for _, name := range []string{"catmullrom", "lanczos2", "lanczos3"} {
+		scaler, err := NewInterpolation(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				dst := image.NewRGBA(image.Rect(0, 0, 500, 375))
+				scaler.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Over, nil)
+			}
+		})
+	}
+}
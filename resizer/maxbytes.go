@@ -0,0 +1,109 @@
+package resizer
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"math"
+
+	"golang.org/x/image/draw"
+)
+
+// maxOutputBytesMinQuality はMaxOutputBytesに収めるために品質を下げるときの下限です。これより下げても収まらない場合は幅・高さを下げます。
+const maxOutputBytesMinQuality = 40
+
+// maxOutputBytesSteps はMaxOutputBytesに収めるために幅・高さを下げる回数の上限です。
+const maxOutputBytesSteps = 8
+
+// fitOutputBytes はimgをformatでエンコードした大きさがopt.MaxOutputBytes以下になるようにエンコードし、
+// 収まった画像とエンコード結果、使った品質(品質を使わない形式では0)を返します。
+//
+// まず設定どおりの品質でエンコードし、収まらない場合は品質をmaxOutputBytesMinQualityまで二分探索で下げて、
+// 収まる最も高い品質を使います。それでも収まらない場合は、上限との比から幅・高さの縮小率を見積もって
+// (1回あたり0.9倍以下)縮小し直し、最低の品質で収まるまでmaxOutputBytesSteps回まで繰り返します。
+// 収まった大きさで品質をもう一度二分探索して上げます。上限の回数で収まらない場合はErrOutputTooLargeを返します。
+func fitOutputBytes(img image.Image, format string, opt Options) (image.Image, []byte, int, error) {
+	limit := opt.MaxOutputBytes
+	encode := func(img image.Image, q int) ([]byte, error) {
+		o := opt
+		o.Quality, o.FormatQuality = q, nil
+		var buf bytes.Buffer
+		if err := encodeImage(&buf, img, format, o); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	q := 0
+	if usesQuality(format, opt) {
+		q = qualityFor(format, opt)
+	}
+	data, err := encode(img, q)
+	if err != nil || int64(len(data)) <= limit {
+		return img, data, q, err
+	}
+
+	minQ := 0
+	if q > 0 {
+		minQ = min(q, maxOutputBytesMinQuality)
+		if data, err = encode(img, minQ); err != nil {
+			return nil, nil, 0, err
+		}
+	}
+	fitted := img
+	for step := 0; int64(len(data)) > limit; step++ {
+		b := fitted.Bounds()
+		if step == maxOutputBytesSteps || (b.Dx() == 1 && b.Dy() == 1) {
+			return nil, nil, 0, fmt.Errorf("%w: %d bytes at %dx%d exceeds %d bytes", ErrOutputTooLarge, len(data), b.Dx(), b.Dy(), limit)
+		}
+		// エンコード後の大きさはおおよそ画素数に比例するため、辺の長さは上限との比の平方根で縮める。
+		ratio := min(0.9, math.Sqrt(float64(limit)/float64(len(data)))*0.95)
+		w := max(1, int(math.Round(float64(b.Dx())*ratio)))
+		h := max(1, int(math.Round(float64(b.Dy())*ratio)))
+		fitted = scaledLike(img, w, h, opt)
+		if data, err = encode(fitted, minQ); err != nil {
+			return nil, nil, 0, err
+		}
+	}
+
+	// 収まる最も高い品質を、収まることがわかっているminQから探す。
+	best := minQ
+	for lo, hi := minQ+1, q; lo <= hi; {
+		mid := (lo + hi) / 2
+		d, err := encode(fitted, mid)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if int64(len(d)) <= limit {
+			best, data, lo = mid, d, mid+1
+		} else {
+			hi = mid - 1
+		}
+	}
+	return fitted, data, best, nil
+}
+
+// scaledLike はimgをw×hに縮小した画像を、imgと同じ種類(グレースケール、パレットなど)の画像として返します。
+// 縮小はいつもimg(最初の画像)から行い、縮小を繰り返してぼやけないようにします。
+func scaledLike(img image.Image, w, h int, opt Options) image.Image {
+	r := image.Rect(0, 0, w, h)
+	var dst draw.Image
+	switch img.(type) {
+	case *image.Gray:
+		dst = image.NewGray(r)
+	case *image.Gray16:
+		dst = image.NewGray16(r)
+	case *image.RGBA64, *image.NRGBA64:
+		dst = image.NewNRGBA64(r)
+	default:
+		dst = image.NewNRGBA(r)
+	}
+	scalerFor(opt).Scale(dst, r, img, img.Bounds(), draw.Src, nil)
+	// パレットの画像は、縮小で増えた色を元のパレットの近い色に戻す。
+	if p, ok := img.(*image.Paletted); ok {
+		pal := image.NewPaletted(r, p.Palette)
+		draw.Draw(pal, r, dst, image.Point{}, draw.Src)
+		return pal
+	}
+	return dst
+}
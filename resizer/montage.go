@@ -0,0 +1,120 @@
+package resizer
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"path/filepath"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// montageLabelHeight はラベルを付ける場合にセルの下に確保する高さです。
+const montageLabelHeight = 16
+
+// montageBackground はセルの余白や画像のないセルの色です。
+var montageBackground = color.White
+
+// WriteMontage はfilesの各画像をopt.Width×opt.Heightのセルに縦横比を保って収め、cols×rowsの格子に並べた一覧画像を出力します。
+// セルの数より画像が多い場合は複数枚に分けて"montage_1.png", "montage_2.png", ...、1枚に収まる場合は"montage.png"とします。
+// 形式はopt.OutFormatが指定されていればその形式、なければPNGです(smallest, auto-smartの場合もPNGです)。
+// 読み込めなかった画像のセルは背景のままにし、そのエラーをfileErrsとして返します。
+// opt.MirrorPermsが有効な場合、出力用ディレクトリのパーミッションは先頭の画像のディレクトリに合わせます。
+func WriteMontage(files []string, cols, rows int, labels bool, opt Options) (outPaths []string, fileErrs []error, err error) {
+	// 一覧画像は特定の入力ファイルに対応しないため、常にOutputDirの直下に出力する。
+	opt.PreserveStructure = false
+	format := opt.OutFormat
+	if format == "" || format == FORMAT_SMALLEST || format == FORMAT_AUTO_SMART {
+		format = TYPE_PNG
+	}
+
+	cellW, cellH := opt.Width, opt.Height
+	imgH := cellH
+	if labels {
+		cellH += montageLabelHeight
+	}
+
+	perSheet := cols * rows
+	sheets := (len(files) + perSheet - 1) / perSheet
+	for sheet := 0; sheet < sheets; sheet++ {
+		canvas := image.NewRGBA(image.Rect(0, 0, cellW*cols, cellH*rows))
+		draw.Draw(canvas, canvas.Bounds(), image.NewUniform(montageBackground), image.Point{}, draw.Src)
+
+		for i := 0; i < perSheet && sheet*perSheet+i < len(files); i++ {
+			path := files[sheet*perSheet+i]
+			cell := image.Rect(0, 0, cellW, imgH).Add(image.Pt(i%cols*cellW, i/cols*cellH))
+
+			src, _, t, err := decodeImage(context.Background(), path, opt)
+			if err != nil {
+				fileErrs = append(fileErrs, fmt.Errorf("%s: %w", path, err))
+				continue
+			}
+			src = autoOrient(fullColor(src), path, t, opt)
+			scalerFor(opt).Scale(canvas, fitRect(src.Bounds(), cell), src, src.Bounds(), draw.Over, nil)
+
+			if labels {
+				drawLabel(canvas, filepath.Base(path), image.Rect(cell.Min.X, cell.Max.Y, cell.Max.X, cell.Max.Y+montageLabelHeight))
+			}
+		}
+
+		name := "montage"
+		if sheets > 1 {
+			name = fmt.Sprintf("montage_%d", sheet+1)
+		}
+		dst, err := createOutput(context.Background(), files[0], name+opt.Suffix+extensions[format], opt)
+		if err != nil {
+			return outPaths, fileErrs, err
+		}
+		err = encodeImage(dst, canvas, format, opt)
+		if err == nil {
+			err = dst.Commit()
+		}
+		dst.Close()
+		if err != nil {
+			return outPaths, fileErrs, err
+		}
+		outPaths = append(outPaths, dst.Name())
+	}
+	return outPaths, fileErrs, nil
+}
+
+// fitRect はsrcの縦横比を保ったままcellに収まる最大の矩形を、cellの中央に配置して返します。
+func fitRect(src, cell image.Rectangle) image.Rectangle {
+	w, h := cell.Dx(), cell.Dy()
+	if src.Dx()*h > src.Dy()*w {
+		h = max(1, src.Dy()*w/src.Dx())
+	} else {
+		w = max(1, src.Dx()*h/src.Dy())
+	}
+	x0 := cell.Min.X + (cell.Dx()-w)/2
+	y0 := cell.Min.Y + (cell.Dy()-h)/2
+	return image.Rect(x0, y0, x0+w, y0+h)
+}
+
+// drawLabel はrの中央にtextを描画します。rに収まらない部分は切り捨てます。
+func drawLabel(dst draw.Image, text string, r image.Rectangle) {
+	face := basicfont.Face7x13
+	d := &font.Drawer{
+		Dst:  clipImage{dst, r},
+		Src:  image.NewUniform(color.Black),
+		Face: face,
+	}
+	x := r.Min.X + (r.Dx()-d.MeasureString(text).Ceil())/2
+	y := r.Min.Y + (r.Dy()+face.Metrics().Ascent.Ceil()-face.Metrics().Descent.Ceil())/2
+	d.Dot = fixed.P(max(r.Min.X, x), y)
+	d.DrawString(text)
+}
+
+// clipImage はrの外への描画を無視するdraw.Imageです。
+type clipImage struct {
+	draw.Image
+	r image.Rectangle
+}
+
+func (c clipImage) Bounds() image.Rectangle {
+	return c.r.Intersect(c.Image.Bounds())
+}
@@ -0,0 +1,30 @@
+package resizer
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// unknownDateDir は撮影日時も更新日時も取得できなかった場合の出力先のディレクトリ名です。
+const unknownDateDir = "unknown"
+
+// dateDir はsrcPathの出力先として"YYYY/MM"のディレクトリを返します。
+// JPEG, PNGはEXIFの撮影日時(DateTimeOriginal)を使い、取得できない場合はファイルの更新日時を使います。
+// どちらも取得できない場合や、opt.NoMetadataDateFallbackが有効で撮影日時が取得できない場合はunknownDateDirを返します。
+func dateDir(srcPath, format string, opt Options) string {
+	if info, err := readExifFile(srcPath, format); err == nil && !info.DateTimeOriginal.IsZero() {
+		return monthDir(info.DateTimeOriginal)
+	}
+	if opt.NoMetadataDateFallback {
+		return unknownDateDir
+	}
+	if fi, err := os.Stat(srcPath); err == nil {
+		return monthDir(fi.ModTime())
+	}
+	return unknownDateDir
+}
+
+func monthDir(t time.Time) string {
+	return filepath.Join(t.Format("2006"), t.Format("01"))
+}
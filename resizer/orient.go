@@ -0,0 +1,62 @@
+package resizer
+
+import "image"
+
+// autoOrient はopt.AutoOrientが有効な場合、srcPathのEXIF(JPEGのAPP1、PNGのeXIfチャンク)に記録された向きに合わせて
+// imgを回転・反転した画像を返します。EXIFがない場合や向きが1(そのまま)の場合はimgをそのまま返します。
+func autoOrient(img image.Image, srcPath, format string, opt Options) image.Image {
+	return applyOrientation(img, exifOrientation(srcPath, format, opt))
+}
+
+// exifOrientation はopt.AutoOrientが有効な場合、srcPathのEXIFに記録された向きを返します。
+// 無効な場合やEXIFがない場合は0を返します。
+func exifOrientation(srcPath, format string, opt Options) int {
+	if !opt.AutoOrient {
+		return 0
+	}
+	info, err := readExifFile(srcPath, format)
+	if err != nil {
+		return 0
+	}
+	return info.Orientation
+}
+
+// applyOrientation はEXIFの向きoに従ってsrcを正しい向きに直した画像を返します。
+// oが2〜8以外の場合はsrcをそのまま返します。
+func applyOrientation(src image.Image, o int) image.Image {
+	if o < 2 || o > 8 {
+		return src
+	}
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	r := image.Rect(0, 0, w, h)
+	// 5〜8は90度回転を含むため、幅と高さが入れ替わる。
+	if o >= 5 {
+		r = image.Rect(0, 0, h, w)
+	}
+
+	dst := newCanvas(src, r)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch o {
+			case 2: // 左右反転
+				dx, dy = w-1-x, y
+			case 3: // 180度回転
+				dx, dy = w-1-x, h-1-y
+			case 4: // 上下反転
+				dx, dy = x, h-1-y
+			case 5: // 左上と右下を結ぶ対角線で反転
+				dx, dy = y, x
+			case 6: // 時計回りに90度回転
+				dx, dy = h-1-y, x
+			case 7: // 右上と左下を結ぶ対角線で反転
+				dx, dy = h-1-y, w-1-x
+			case 8: // 反時計回りに90度回転
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, src.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
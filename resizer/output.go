@@ -0,0 +1,73 @@
+package resizer
+
+import (
+	"context"
+	"io"
+)
+
+// OutputWriter は出力ファイル1つ分の書き込み先です。Commitで書き込んだ内容を確定します。
+// CommitせずにCloseした場合は書き込んだ内容を破棄し、Commit後のCloseは何もしません。
+type OutputWriter interface {
+	io.Writer
+	// Name は結果(Result.OutputPath)に記録する出力先のパスを返します。
+	Name() string
+	Commit() error
+	Close() error
+}
+
+// NopCommitter はwに直接書き込み、Commit, Closeでは何もしないOutputWriterを返します。
+// 標準出力など、書き込んだ内容を取り消せない出力先をOptions.NewOutputで使う場合に使います。
+func NopCommitter(w io.Writer, name string) OutputWriter {
+	return nopCommitter{Writer: w, name: name}
+}
+
+type nopCommitter struct {
+	io.Writer
+	name string
+}
+
+func (w nopCommitter) Name() string  { return w.name }
+func (w nopCommitter) Commit() error { return nil }
+func (w nopCommitter) Close() error  { return nil }
+
+// ctxOutput はctxがキャンセルされた後のWrite, Commitでctxのエラーを返すOutputWriterです。
+// タイムアウトや中断で失敗とした処理が、その後に出力ファイルを確定してしまわないようにします。
+type ctxOutput struct {
+	OutputWriter
+	ctx context.Context
+}
+
+// withContext はwへの書き込みとCommitを、ctxがキャンセルされた後は行わないようにします。
+func withContext(ctx context.Context, w OutputWriter) OutputWriter {
+	return ctxOutput{OutputWriter: w, ctx: ctx}
+}
+
+func (w ctxOutput) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.OutputWriter.Write(p)
+}
+
+func (w ctxOutput) Commit() error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	return w.OutputWriter.Commit()
+}
+
+// replaceOutput はsrcPath自身を置き換えるための書き込み先を返します。
+func replaceOutput(ctx context.Context, srcPath string, opt Options) (OutputWriter, error) {
+	if opt.NewOutput != nil {
+		w, err := opt.NewOutput(srcPath)
+		if err != nil {
+			return nil, err
+		}
+		return withContext(ctx, w), nil
+	}
+	f, err := createReplacement(srcPath, opt.TmpDir)
+	if err != nil {
+		return nil, err
+	}
+	return withContext(ctx, f), nil
+}
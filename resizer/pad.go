@@ -0,0 +1,52 @@
+package resizer
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// nextPow2 はn以上で最小の2のべき乗を返します。
+func nextPow2(n int) int {
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
+
+// padToPow2 はimgを左上に置き、幅・高さをそれぞれ次の2のべき乗まで広げた画像を返します。
+// 広げた部分はbgで塗りつぶします。bgがnilの場合は透過になります。
+func padToPow2(img draw.RGBA64Image, bg color.Color) draw.RGBA64Image {
+	b := img.Bounds()
+	r := image.Rect(0, 0, nextPow2(b.Dx()), nextPow2(b.Dy()))
+	if r.Eq(b) {
+		return img
+	}
+	padded := newCanvas(img, r)
+	if bg != nil {
+		draw.Draw(padded, r, image.NewUniform(bg), image.Point{}, draw.Src)
+	}
+	draw.Draw(padded, b.Sub(b.Min), img, b.Min, draw.Over)
+	return padded
+}
+
+// ParseHexColor は"#rrggbb"または"#rrggbbaa"形式(#は省略可)の色を返します。
+func ParseHexColor(s string) (color.Color, error) {
+	h := strings.TrimPrefix(s, "#")
+	if len(h) != 6 && len(h) != 8 {
+		return nil, fmt.Errorf("%q is not #rrggbb or #rrggbbaa", s)
+	}
+	v, err := strconv.ParseUint(h, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("%q is not #rrggbb or #rrggbbaa", s)
+	}
+	if len(h) == 6 {
+		v = v<<8 | 0xff
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
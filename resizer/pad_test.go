@@ -0,0 +1,62 @@
+package resizer
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"path/filepath"
+	"testing"
+)
+
+func TestNextPow2(t *testing.T) {
+	tests := []struct{ n, want int }{
+		{1, 1}, {2, 2}, {3, 4}, {200, 256}, {256, 256}, {300, 512}, {1025, 2048},
+	}
+	for _, tt := range tests {
+		if got := nextPow2(tt.n); got != tt.want {
+			t.Errorf("nextPow2(%d) = %d, want %d", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestPow2Canvas(t *testing.T) {
+	red := color.NRGBA{255, 0, 0, 255}
+	tests := []struct {
+		name         string
+		w, h, width  int
+		bg           color.Color
+		wantW, wantH int
+		wantPad      color.NRGBA
+		padX, padY   int
+		hasPadding   bool
+	}{
+		{name: "300x200 transparent", w: 300, h: 200, width: 300, wantW: 512, wantH: 256, padX: 400, padY: 100, hasPadding: true},
+		{name: "300x200 background", w: 300, h: 200, width: 300, bg: red, wantW: 512, wantH: 256, wantPad: red, padX: 100, padY: 230, hasPadding: true},
+		{name: "already pow2", w: 512, h: 256, width: 256, wantW: 256, wantH: 128},
+	}
+	gray := color.NRGBA{200, 200, 200, 255}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := image.NewNRGBA(image.Rect(0, 0, tt.w, tt.h))
+			draw.Draw(img, img.Bounds(), image.NewUniform(gray), image.Point{}, draw.Src)
+			dir := t.TempDir()
+			src := writePNG(t, dir, "a.png", img)
+			r, err := ResizeImage(src, Options{Width: tt.width, Pow2: true, Background: tt.bg, OutputDir: filepath.Join(dir, "out")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, _ := decodeFile(t, r.OutputPath)
+			if r.Width != tt.wantW || r.Height != tt.wantH || out.Bounds() != image.Rect(0, 0, tt.wantW, tt.wantH) {
+				t.Fatalf("result %dx%d, file %v, want %dx%d", r.Width, r.Height, out.Bounds(), tt.wantW, tt.wantH)
+			}
+			if got := color.NRGBAModel.Convert(out.At(10, 10)); got != gray {
+				t.Errorf("content pixel = %v, want %v", got, gray)
+			}
+			if tt.hasPadding {
+				if got := color.NRGBAModel.Convert(out.At(tt.padX, tt.padY)); got != tt.wantPad {
+					t.Errorf("padding pixel (%d,%d) = %v, want %v", tt.padX, tt.padY, got, tt.wantPad)
+				}
+			}
+		})
+	}
+}
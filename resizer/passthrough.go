@@ -0,0 +1,33 @@
+package resizer
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// FORMAT_COPY はCopyUnsupported, CopySkippedによってそのままコピーしたファイルのResult.Formatです。
+const FORMAT_COPY = "copy"
+
+// copySource はリサイズしないsrcPathを、出力先に同じファイル名でそのままコピーします。
+func copySource(ctx context.Context, srcPath string, opt Options) (*Result, error) {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	dst, err := createOutput(ctx, srcPath, filepath.Base(srcPath), opt)
+	if err != nil {
+		return nil, err
+	}
+	defer dst.Close()
+	if _, err := io.Copy(dst, src); err != nil {
+		return nil, err
+	}
+	if err := dst.Commit(); err != nil {
+		return nil, err
+	}
+	return &Result{SourcePath: srcPath, OutputPath: dst.Name(), Format: FORMAT_COPY}, nil
+}
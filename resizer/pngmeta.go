@@ -0,0 +1,97 @@
+package resizer
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+)
+
+// pngColorChunks はKeepColorChunksで入力のPNGから出力のPNGにコピーする、色の扱いに関するチャンクです。
+// cICPはHDR(PQ, HLG)の画像で色空間と伝達関数を示します。いずれもPLTE, IDATより前にある必要があります。
+var pngColorChunks = map[string]bool{
+	"gAMA": true,
+	"cHRM": true,
+	"sRGB": true,
+	"iCCP": true,
+	"cICP": true,
+}
+
+// pngColorInfo は入力のPNGから読み込んだ、色の扱いに関するチャンクです。
+type pngColorInfo struct {
+	// chunks はpngColorChunksのチャンクで、ファイル内の順番に並びます。
+	chunks []pngChunk
+	// gray は入力のIHDRのカラータイプがグレースケールかどうかです。
+	gray bool
+}
+
+// readPNGColorInfo はpathのPNGファイルの最初のIDATより前にあるpngColorChunksのチャンクを読み込みます。
+func readPNGColorInfo(path string) (*pngColorInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	var sig [8]byte
+	if _, err := io.ReadFull(br, sig[:]); err != nil {
+		return nil, err
+	}
+	if string(sig[:]) != pngSignature {
+		return nil, errors.New("not a png")
+	}
+	info := &pngColorInfo{}
+	for {
+		c, err := readPNGChunk(br)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case c.typ == "IHDR":
+			info.gray = isGrayPNG(c.data)
+		case c.typ == "IDAT" || c.typ == "IEND":
+			return info, nil
+		case pngColorChunks[c.typ]:
+			info.chunks = append(info.chunks, c)
+		}
+	}
+}
+
+// isGrayPNG はIHDRのデータihdrのカラータイプがグレースケール(0: グレー, 4: グレーとアルファ)かどうかを返します。
+func isGrayPNG(ihdr []byte) bool {
+	return len(ihdr) > 9 && (ihdr[9] == 0 || ihdr[9] == 4)
+}
+
+// addPNGChunks はエンコード済みのPNGのdataのIHDRの直後にchunksを入れたものを返します。
+func addPNGChunks(data []byte, chunks []pngChunk) ([]byte, error) {
+	// シグネチャ(8バイト)の後の最初のチャンクは必ずIHDR(長さ・種類・13バイト・CRCで25バイト)になる。
+	const ihdrEnd = 8 + 25
+	if len(data) < ihdrEnd || string(data[:8]) != pngSignature || string(data[12:16]) != "IHDR" {
+		return nil, errors.New("not a png")
+	}
+	var buf bytes.Buffer
+	for _, c := range chunks {
+		if err := writePNGChunk(&buf, c.typ, c.data); err != nil {
+			return nil, err
+		}
+	}
+	return insertBytes(data, ihdrEnd, buf.Bytes()), nil
+}
+
+// addColorChunks はエンコード済みのPNGのdataに、入力から読み込んだinfoのチャンクを入れたものを返します。
+// ICCプロファイルはグレースケールとカラーで種類が異なるため、出力のカラータイプが入力とグレースケールかどうかで
+// 異なる場合はiCCPを入れません。
+func addColorChunks(data []byte, info *pngColorInfo) ([]byte, error) {
+	// IHDRのデータはシグネチャ(8バイト)と長さ・種類(8バイト)の後にある。
+	outGray := len(data) >= 8+8+13 && isGrayPNG(data[16:])
+	var kept []pngChunk
+	for _, c := range info.chunks {
+		if c.typ == "iCCP" && outGray != info.gray {
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return addPNGChunks(data, kept)
+}
@@ -0,0 +1,112 @@
+package resizer
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeepColorChunksRoundTrip(t *testing.T) {
+	var (
+		gama = pngChunk{"gAMA", []byte{0, 0, 0xb1, 0x8f}}
+		chrm = pngChunk{"cHRM", []byte{0, 0, 0x7a, 0x26, 0, 0, 0x80, 0x84, 0, 0, 0xfa, 0, 0, 0, 0x80, 0xe8, 0, 0, 0x75, 0x30, 0, 0, 0xea, 0x60, 0, 0, 0x3a, 0x98, 0, 0, 0x17, 0x70}}
+		srgb = pngChunk{"sRGB", []byte{0}}
+		iccp = pngChunk{"iCCP", []byte("prof\x00\x00\x78\x9c\x03\x00\x00\x00\x00\x01")}
+		cicp = pngChunk{"cICP", []byte{9, 16, 0, 1}}
+		tim  = pngChunk{"tIME", []byte{7, 0xe8, 1, 1, 0, 0, 0}}
+	)
+	tests := []struct {
+		name   string
+		chunks []pngChunk
+		opt    Options
+		want   []pngChunk
+	}{
+		{"gAMA cHRM sRGB", []pngChunk{gama, chrm, srgb, tim}, Options{KeepColorChunks: true}, []pngChunk{gama, chrm, srgb}},
+		{"iCCP", []pngChunk{iccp}, Options{KeepColorChunks: true}, []pngChunk{iccp}},
+		{"HDR cICP", []pngChunk{cicp, gama}, Options{KeepColorChunks: true}, []pngChunk{cicp, gama}},
+		{"iCCP dropped for gray output", []pngChunk{gama, iccp}, Options{KeepColorChunks: true, ColorModel: COLOR_GRAY}, []pngChunk{gama}},
+		{"with comment", []pngChunk{srgb}, Options{KeepColorChunks: true, Comment: "x"}, []pngChunk{srgb}},
+		{"disabled", []pngChunk{gama, chrm, srgb, iccp}, Options{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, gradient(40, 30)); err != nil {
+				t.Fatal(err)
+			}
+			data, err := addPNGChunks(buf.Bytes(), tt.chunks)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dir := t.TempDir()
+			src := filepath.Join(dir, "h.png")
+			if err := os.WriteFile(src, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			tt.opt.Width, tt.opt.OutputDir = 20, filepath.Join(dir, "out")
+			r, err := ResizeImage(src, tt.opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := os.ReadFile(r.OutputPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := png.Decode(bytes.NewReader(out)); err != nil {
+				t.Fatalf("output does not decode: %v", err)
+			}
+
+			// 色のチャンクはすべてIDATより前にある必要がある。
+			var got []pngChunk
+			for _, c := range pngChunks(t, out) {
+				if c.typ == "IDAT" {
+					break
+				}
+				if pngColorChunks[c.typ] {
+					got = append(got, c)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("color chunks = %v, want %v", chunkTypes(got), chunkTypes(tt.want))
+			}
+			for i := range got {
+				if got[i].typ != tt.want[i].typ || !bytes.Equal(got[i].data, tt.want[i].data) {
+					t.Errorf("chunk %d = %s %x, want %s %x", i, got[i].typ, got[i].data, tt.want[i].typ, tt.want[i].data)
+				}
+			}
+		})
+	}
+}
+
+func chunkTypes(chunks []pngChunk) []string {
+	types := make([]string, len(chunks))
+	for i, c := range chunks {
+		types[i] = c.typ
+	}
+	return types
+}
+
+func TestReadPNGColorInfoGray(t *testing.T) {
+	tests := []struct {
+		name string
+		img  image.Image
+		want bool
+	}{
+		{"gray", image.NewGray(image.Rect(0, 0, 4, 4)), true},
+		{"color", gradient(4, 4), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := readPNGColorInfo(writePNG(t, t.TempDir(), "a.png", tt.img))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.gray != tt.want {
+				t.Errorf("gray = %v, want %v", info.gray, tt.want)
+			}
+		})
+	}
+}
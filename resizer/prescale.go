@@ -0,0 +1,24 @@
+package resizer
+
+import (
+	"image"
+
+	"golang.org/x/image/draw"
+)
+
+// fastHugeRatio は-fastHugeで前段の縮小を行う、元の画像と縮小後のサイズの比の下限です。
+const fastHugeRatio = 4
+
+// prescale はsrcのrの範囲を、縮小後のサイズw×hとの比がfastHugeRatioを下回るまで1/2ずつ縮小し、
+// 縮小した画像とその範囲を返します。比がfastHugeRatio未満の場合はsrc, rをそのまま返します。
+//
+// ちょうど1/2の縮小では双線形補間が2×2画素の平均になるため、高速なApproxBiLinearでも
+// 折り返しのない縮小になります。最後の縮小は元のサイズの2倍以上から行うため、画質は仕上げの縮小で決まります。
+func prescale(src image.Image, r image.Rectangle, w, h int) (image.Image, image.Rectangle) {
+	for r.Dx() >= w*fastHugeRatio && r.Dy() >= h*fastHugeRatio {
+		half := newCanvas(src, image.Rect(0, 0, r.Dx()/2, r.Dy()/2))
+		draw.ApproxBiLinear.Scale(half, half.Bounds(), src, r, draw.Src, nil)
+		src, r = half, half.Bounds()
+	}
+	return src, r
+}
@@ -0,0 +1,57 @@
+package resizer
+
+import (
+	"context"
+	"image"
+
+	"golang.org/x/image/draw"
+)
+
+// -previewで指定できる比較画像の並べ方です。
+const (
+	PREVIEW_HORIZONTAL = "horizontal"
+	PREVIEW_VERTICAL   = "vertical"
+)
+
+// previewGap は比較画像で元の画像とリサイズ後の画像の間に空ける幅です。
+const previewGap = 4
+
+// previewReference はsrcのrの範囲を、比較用にw×hに収まるよう縦横比を保って縮小した画像を返します。
+// 設定による違いを比べられるよう、縮小方法はopt.Kernelなどによらず常にCatmullRomを使います。
+func previewReference(src image.Image, r image.Rectangle, w, h int) image.Image {
+	fit := fitRect(r, image.Rect(0, 0, w, h))
+	dst := image.NewNRGBA(fit.Sub(fit.Min))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, r, draw.Src, nil)
+	return dst
+}
+
+// writePreview はbeforeとafterをopt.Previewの向きに並べた比較画像を、"名前_preview.png"として書き出します。
+// 比較画像は再圧縮で見た目が変わらないよう、出力形式によらずPNGで書き出します。
+// afterはエンコードする前の画像のため、JPEGなどの圧縮による劣化は比較画像に含まれません。
+func writePreview(ctx context.Context, before, after image.Image, srcPath string, opt Options) (string, error) {
+	bb, ab := before.Bounds(), after.Bounds()
+	size := image.Pt(bb.Dx()+previewGap+ab.Dx(), max(bb.Dy(), ab.Dy()))
+	offset := image.Pt(bb.Dx()+previewGap, 0)
+	if opt.Preview == PREVIEW_VERTICAL {
+		size = image.Pt(max(bb.Dx(), ab.Dx()), bb.Dy()+previewGap+ab.Dy())
+		offset = image.Pt(0, bb.Dy()+previewGap)
+	}
+
+	canvas := image.NewNRGBA(image.Rectangle{Max: size})
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(montageBackground), image.Point{}, draw.Src)
+	draw.Draw(canvas, bb.Sub(bb.Min), before, bb.Min, draw.Over)
+	draw.Draw(canvas, ab.Sub(ab.Min).Add(offset), after, ab.Min, draw.Over)
+
+	dst, err := createOutput(ctx, srcPath, outName(srcPath, opt.Suffix+"_preview", extensions[TYPE_PNG], opt), opt)
+	if err != nil {
+		return "", err
+	}
+	defer dst.Close()
+	if err := encodeImage(dst, canvas, TYPE_PNG, opt); err != nil {
+		return "", err
+	}
+	if err := dst.Commit(); err != nil {
+		return "", err
+	}
+	return dst.Name(), nil
+}
@@ -0,0 +1,55 @@
+package resizer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// qualityFor はformatの出力に使う品質を返します。opt.FormatQualityにformatがあればその値を、なければopt.Qualityを使います。
+// opt.SSIMで品質を自動で決める場合は、決めた品質(opt.Quality)を使います。
+func qualityFor(format string, opt Options) int {
+	q := opt.Quality
+	if fq, ok := opt.FormatQuality[format]; ok && opt.SSIM <= 0 {
+		q = fq
+	}
+	if q == 0 {
+		q = DefaultQuality
+	}
+	return q
+}
+
+// ParseQuality は"85"のような全形式共通の品質と、"jpeg=85,webp=80"のような形式ごとの品質を解析します。
+// 両方を"85,webp=80"のように組み合わせることもできます。共通の品質が指定されていない場合は0を返します。
+func ParseQuality(s string) (int, map[string]int, error) {
+	var quality int
+	var perFormat map[string]int
+	for _, item := range strings.Split(s, ",") {
+		format, value, hasFormat := strings.Cut(strings.TrimSpace(item), "=")
+		if !hasFormat {
+			format, value = "", format
+		}
+		q, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || q < 1 || q > 100 {
+			return 0, nil, fmt.Errorf("%q is not an integer between 1 and 100", value)
+		}
+		format = strings.ToLower(strings.TrimSpace(format))
+		switch {
+		case format == "":
+			if quality != 0 {
+				return 0, nil, fmt.Errorf("quality for all formats is given twice")
+			}
+			quality = q
+		case format != TYPE_JPG && format != TYPE_WEBP:
+			return 0, nil, fmt.Errorf("%q does not use quality (only jpeg and webp do)", format)
+		case perFormat[format] != 0:
+			return 0, nil, fmt.Errorf("quality for %s is given twice", format)
+		default:
+			if perFormat == nil {
+				perFormat = make(map[string]int)
+			}
+			perFormat[format] = q
+		}
+	}
+	return quality, perFormat, nil
+}
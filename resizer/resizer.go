@@ -0,0 +1,1034 @@
+// Package resizer は画像ファイルのリサイズと、複数のファイルの一括変換を行います。
+// コマンドラインツール(image-resizer)は、フラグの指定をOptionsにしてこのパッケージで変換します。
+package resizer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/gen2brain/webp"
+	"golang.org/x/image/draw"
+)
+
+const (
+	TYPE_JPG  = "jpeg"
+	TYPE_PNG  = "png"
+	TYPE_WEBP = "webp"
+)
+
+// DefaultQuality はJPEG, 非可逆WebPの既定の品質です。
+const DefaultQuality = 100
+
+// DefaultMaxPixels はデコードを許可する入力画像の画素数の既定の上限です。
+const DefaultMaxPixels = 100_000_000
+
+// SIZE_AUTO はOptions.Width, Heightに指定すると、もう一方と元の縦横比から自動で計算することを表します。
+// 0(指定なし)でも、もう一方だけが指定されていれば同じく計算しますが、-1はもう一方の指定が必須です。
+const SIZE_AUTO = -1
+
+// Options はResizeImageに渡す変換設定です。
+type Options struct {
+	// Width, Height はリサイズ後の幅・高さです。一方をSIZE_AUTOにした場合は、もう一方(1以上)と元の縦横比から計算します。
+	// 両方をSIZE_AUTOにすることや、-1より小さい値は指定できません。
+	Width  int
+	Height int
+	// OutputDir は出力先のディレクトリです。空の場合は入力ファイルと同じディレクトリに出力し、PreserveStructureは使われません。
+	OutputDir string
+	Suffix    string
+	// Square が有効な場合、中央から短辺を一辺とする正方形を切り抜いてからリサイズします。
+	Square bool
+	// Circle が有効な場合、Squareと同じく中央を正方形に切り抜いてから円形のアルファマスクを適用します。
+	// 出力形式がJPEGになる場合はPNGで出力します。
+	Circle bool
+	// KeepAspectRatio が有効な場合、Width, Heightが両方指定されていても縦横比を保ち、その範囲に収まるサイズにします。
+	// 無効な場合はWidth×Heightちょうどに変形します。
+	KeepAspectRatio bool
+	// StrictAspect が有効な場合、KeepAspectRatioが無効でWidth×Heightの縦横比が元の画像とstrictAspectTolerance以上違うときは、
+	// 変形させずにErrAspectMismatchを返します。
+	StrictAspect bool
+	// Megapixels が0より大きい場合、縦横比を保ったまま画素数がおよそMegapixels×100万になるサイズに変換します。
+	// Width, Heightとは併用できません。
+	Megapixels float64
+	// ScaleX, ScaleY のいずれかが0より大きい場合、元の幅・高さにそれぞれの倍率を掛けたサイズ(四捨五入)に変換します。
+	// 縦横比は保たれません。0以下の側は1倍になります。Width, Height, Megapixelsより優先されます。
+	ScaleX float64
+	ScaleY float64
+	// OutFormat は出力形式です(TYPE_JPG, TYPE_PNG, TYPE_WEBP)。空文字の場合は入力と同じ形式で出力します。
+	// FORMAT_SMALLEST の場合は候補の形式のうちファイルサイズが最も小さくなるものを選びます。
+	// FORMAT_AUTO_SMART の場合は縮小後の画像の内容から、写真はJPEG、図やイラストはPNGを選びます(smartFormatを参照)。
+	OutFormat string
+	// AutoFormatMaxColors, AutoFormatFlatRatio はFORMAT_AUTO_SMARTでPNGを選ぶ色数の上限と、平らな部分の割合の下限です。
+	// 0の場合はDefaultAutoFormatMaxColors, DefaultAutoFormatFlatRatioを使います。
+	AutoFormatMaxColors int
+	AutoFormatFlatRatio float64
+	// Quality はJPEG, 非可逆WebPの品質(1〜100)です。0の場合はDefaultQualityになります。
+	Quality int
+	// FormatQuality は出力形式ごとの品質です。含まれる形式ではQualityの代わりに使います。
+	FormatQuality map[string]int
+	// SSIM が0より大きい場合、JPEG, 非可逆WebPの品質を自動で決めます。
+	// 元の画像とのSSIMがこの値以上になる最も低い品質を使い、Quality, FormatQualityは使われません。
+	SSIM float64
+	// WebPLossless が有効な場合、WebPを可逆圧縮で出力します。Qualityは使われません。
+	WebPLossless bool
+	// ChromaSubsampling はJPEG出力時の色差サブサンプリングです("444", "440", "422", "420")。
+	// 空文字の場合はDefaultChromaSubsamplingになります。
+	ChromaSubsampling string
+	// PNGCompression はPNG出力時の圧縮レベルです(pngCompressionLevelsのキー)。空文字の場合は"default"になります。
+	// アニメーションPNGとICOでは使われません。
+	PNGCompression string
+	// MaxPixels は入力画像の幅×高さの上限です。超える画像はデコード前にエラーにします。0以下の場合は制限しません。
+	MaxPixels int64
+	// ICO が有効な場合、ICOSizesの各サイズに縮小した画像をまとめた.icoファイルを出力します。
+	// Width, Height, OutFormatなどのサイズ・形式の指定は使われません。
+	ICO bool
+	// TrimTransparent が有効な場合、上下左右の完全に透明(アルファが0)な行・列を取り除いた範囲をリサイズします。
+	TrimTransparent bool
+	// AspectWidth, AspectHeight が指定されている場合、リサイズに使う範囲をAspectWidth:AspectHeightの縦横比の最も大きい矩形に切り抜きます。
+	// 切り抜く位置はGravityで指定します。Width, Heightなどのサイズの指定がない場合は、切り抜いた大きさのまま出力します。
+	AspectWidth, AspectHeight int
+	// Gravity はAspectWidth, AspectHeightで切り抜くときに残す位置です(GRAVITY_CENTERなど)。空の場合は中央です。
+	Gravity string
+	// RoundTo が1より大きい場合、計算した幅・高さをそれぞれRoundToの倍数のうち最も近いものに丸めます。
+	// 動画のエンコーダなどで幅・高さが2や16の倍数である必要がある場合に使います。
+	RoundTo int
+	// Srcset が指定されている場合、指定した幅ごとに高さを縦横比から計算して縮小し、"名前_幅w.拡張子"として書き出します。
+	// 画像の読み込みは1回だけ行います。元の画像より大きい幅は作りません。Width, Heightなどのサイズの指定は使われません。
+	Srcset []int
+	// StripScale が有効な場合、縮小では画像全体の中間の複製を作らずに、元の画像を上から少しずつRGBAに変換しながら縮小します。
+	// 作らなくなるのは、YCbCrのJPEGを画像全体でRGBAに変換した複製と、縦方向に縮小する前の中間結果です。
+	// 元の画像のデコードは通常どおり画像全体を一度に行うため、メモリ使用量の最大値はデコード結果を下回らず、元の画像が大きいほど増えます。
+	// 横に長いパノラマなどを大きく縮小する場合に効果があります。拡大する場合や、補間方法がnearestの場合は使われません。
+	StripScale bool
+	// Preview が"horizontal"または"vertical"の場合、元の画像を出力と同じ大きさに縮小したものとリサイズ後の画像を
+	// 横または縦に並べた比較画像を、出力ファイルとは別に"名前_preview.png"として書き出します。
+	// ICOとアニメーションPNGの出力では作りません。
+	Preview string
+	// Pow2 が有効な場合、縮小後の画像を左上に置いたまま、幅・高さを次の2のべき乗までBackgroundで広げます。
+	Pow2 bool
+	// Background は余白を塗りつぶす色です。nilの場合は透過になります(JPEGでは黒になります)。
+	Background color.Color
+	// BackgroundImage が指定されている場合、縮小後の画像(Pow2の余白を含む)の大きさいっぱいに縦横比を保って拡大・縮小し、
+	// 縮小後の画像の下に敷きます。Backgroundは使われません。
+	BackgroundImage image.Image
+	// NoUpscale が有効な場合、元の画像より大きくなるサイズが指定されても元のサイズに収まるようにします。
+	NoUpscale bool
+	// AllowUpscale が有効な場合、元の画像より大きくなるときの警告をResult.Warningsに入れません。
+	AllowUpscale bool
+	// Tile が0より大きい場合、縮小後の画像をTile×Tileのタイルに分割し、行・列の番号を付けた別々のファイルとして出力します。
+	// 右端・下端のタイルはTileより小さくなることがあります。
+	Tile int
+	// OutName が指定されている場合、入力ファイル名の代わりにこの名前(拡張子なし)で出力します。
+	OutName string
+	// FrameStep が2以上の場合、アニメーションPNGを最初のフレームから数えてFrameStepフレームごとに1フレームだけ残して出力します。
+	// 取り除いたフレームの表示時間は直前に残したフレームに足すため、全体の再生時間は変わりません。
+	// アニメーションPNGでない入力や、アニメーションのまま出力しない場合(OutFormatがjpeg, webp, smallestの場合やTile)はErrNotAnimatedを返します。
+	FrameStep int
+	// MaxOutputBytes が0より大きい場合、出力ファイルがこのバイト数以下になるよう、品質を下げ、それでも収まらない場合は幅・高さを下げます。
+	// 手順はfitOutputBytesを参照してください。収まらない場合はErrOutputTooLargeを返します。
+	// smallest, Tile, Pow2とは併用できず、ICOとアニメーションPNGの出力では使われません。
+	MaxOutputBytes int64
+	// ExifThumbnail が有効な場合、入力のEXIFにサムネイルがあれば、リサイズ後の画像から長辺160pxのサムネイルを作り直し、
+	// それだけを持つEXIFを出力のJPEGに入れます。入力のEXIFは出力にコピーしないため、無効な場合は古いサムネイルは残りません。
+	ExifThumbnail bool
+	// VerifyOutput が有効な場合、書き出したファイルを読み込み直してデコードし、幅・高さが出力したサイズと一致することを確かめます。
+	// 確かめられなかった場合はErrVerifyFailedを返します。NewOutputを指定した場合は確かめません。
+	VerifyOutput bool
+	// DimSuffix が有効な場合、Suffixの後に実際に出力する画像の幅・高さを"-幅x高さ"として付けます。例: photo-800x600.jpg
+	DimSuffix bool
+	// HashName が有効な場合、出力ファイル名をエンコード後の内容のSHA-256の先頭hashNameLength文字にします。Suffixは使われません。
+	HashName bool
+	// BaseDir は入力ファイルの基準となるディレクトリです。PreserveStructureで使います。
+	BaseDir string
+	// PreserveStructure が有効な場合、BaseDirの下にある入力ファイルは、BaseDirからの相対的なディレクトリ構成をOutputDirの下に再現して出力します。
+	PreserveStructure bool
+	// Replace が有効な場合、入力ファイル自身をリサイズ後の画像で置き換えます。入力と同じ形式でのみ出力でき、
+	// OutputDir, Suffix, OutName, HashNameなどの出力先の指定とProtectedPathsは使われません。ICO, Tileとは併用できません。
+	Replace bool
+	// ProtectedPaths は上書きしてはいけないファイルの絶対パスです。出力先がこれに含まれる場合はErrOverwriteInputを返します。
+	ProtectedPaths map[string]bool
+	// AutoOrient が有効な場合、EXIF(JPEGのAPP1、PNGのeXIfチャンク)の向きに合わせて回転・反転してからリサイズします。
+	AutoOrient bool
+	// OrganizeByDate が有効な場合、撮影日時(JPEG, PNGのEXIFのDateTimeOriginal、ない場合はファイルの更新日時)の
+	// 年・月ごとのOutputDir/YYYY/MMに出力します。
+	OrganizeByDate bool
+	// NoMetadataDateFallback が有効な場合、OrganizeByDateでEXIFの撮影日時がない(または壊れている)画像は、
+	// ファイルの更新日時を使わずにOutputDir/unknownに出力します。
+	NoMetadataDateFallback bool
+	// TmpDir は書き込み中の一時ファイルを作成するディレクトリです。空の場合は出力先と同じディレクトリに作成します。
+	// 書き込みが終わった一時ファイルは出力先に移動するため、別のファイルシステムにある場合はコピーになります。
+	TmpDir string
+	// MirrorPerms が有効な場合、出力用ディレクトリを作成するときに入力ファイルのあるディレクトリと同じパーミッションにします。
+	// 無効な場合は0755で作成します。
+	MirrorPerms bool
+	// Dither が有効な場合、減色時にFloyd–Steinbergの誤差拡散を行います。
+	// パレット形式のPNGを入力してPNGで出力する場合は元のパレットのまま、16bitの入力は8bitに落として出力します。
+	Dither bool
+	// ColorModel が指定されている場合、出力前に画像をそのカラーモデルに変換します(COLOR_RGB, COLOR_RGBA, COLOR_GRAY)。
+	// COLOR_RGB, COLOR_GRAYでは透過部分をBackgroundと合成します。COLOR_RGBAはJPEGでは出力できません。
+	ColorModel string
+	// Comment が指定されている場合、出力画像にコメントとして埋め込みます(JPEGはCOMセグメント、PNGはキーワードCommentのtEXt/iTXtチャンク)。
+	// WebPでは使われません。
+	Comment string
+	// KeepColorChunks が有効な場合、PNGからPNGに出力するときに入力のgAMA, cHRM, sRGB, iCCP, cICPチャンクをそのまま出力にコピーします。
+	KeepColorChunks bool
+	// Normalize が有効な場合、縮小後の画像のチャンネルごとの最小値・最大値を0〜255に引き伸ばします。
+	Normalize bool
+	// FastHuge が有効な場合、縮小後のサイズの4倍以上ある画像は、縮小後のサイズの2〜4倍まで
+	// 1/2ずつ高速に縮小してからScalerで縮小します。
+	FastHuge bool
+	// Scaler は縮小に使う補間方法です。nilの場合はdraw.CatmullRomを使います。
+	Scaler draw.Scaler
+	// NewOutput が指定されている場合、出力ファイルは本来の出力先のパスを渡してNewOutputが返す書き込み先に書き込みます。
+	// 出力用ディレクトリの作成は行いません。nilの場合は出力先と同じディレクトリ(TmpDir)の一時ファイルに書き込み、完了してから出力先に移動します。
+	NewOutput func(path string) (OutputWriter, error)
+	// OnlyLargerThanBytes, OnlyWiderThan が0より大きい場合、ファイルサイズ(バイト)または幅(px)がその値を超える画像だけを処理し、
+	// それ以外はデコードせずにErrBelowThresholdを返します。両方を指定した場合はどちらか一方を超えていれば処理します。
+	OnlyLargerThanBytes int64
+	OnlyWiderThan       int
+	// CopySkipped が有効な場合、OnlyLargerThanBytes, OnlyWiderThanで処理しなかった画像を、
+	// エラーにせずに出力先へ同じファイル名でそのままコピーします。結果のFormatはFORMAT_COPYになります。
+	CopySkipped bool
+	// CopyUnsupported が有効な場合、入力の形式がjpeg, png以外のファイルや画像でないファイルを、
+	// エラーにせずに出力先へ同じファイル名でそのままコピーします。結果のFormatはFORMAT_COPYになります。
+	CopyUnsupported bool
+
+	// 以下はBatchResizeでのみ使われます。
+
+	// Workers は同時に処理するファイル数です。1以下の場合は1ファイルずつ処理します。
+	Workers int
+	// FileTimeout が0より大きい場合、1ファイルあたりの処理時間の上限とし、超えたファイルはエラーにします。
+	FileTimeout time.Duration
+	// TotalTimeout が0より大きい場合、バッチ全体の処理時間の上限とし、超えた時点で処理中のファイルを含む残りのファイルの処理を中止します。
+	// 処理されなかったファイルの結果はErrSkippedとcontext.DeadlineExceededの両方に当てはまるエラーになります。
+	TotalTimeout time.Duration
+	// FailFast が有効な場合、いずれかのファイルでエラーが発生した時点で残りのファイルの処理を中止します。
+	FailFast bool
+	// SkipUnsupported が有効な場合、入力の形式がjpeg, png以外のファイルはErrUnsupportedFormatを結果に入れるだけで、
+	// FailFastによる中断の対象にしません。
+	SkipUnsupported bool
+	// MaxConcurrentDecodes が0より大きい場合、Workersによらず、同時にデコードして縮小する画像の数をこの数までにします。
+	// 元のサイズの画像を展開している間のメモリ使用量を抑えるために使います。
+	MaxConcurrentDecodes int
+	// Sequence が指定されている場合、出力ファイル名をSequenceに連番を付けた名前にします。
+	// 連番はSequenceStartから始まり、SequencePadの桁数にゼロ埋めします。
+	// Workersが1以下の場合は出力に成功したファイルにだけ、2以上の場合は入力の順番で振ります。
+	Sequence      string
+	SequenceStart int
+	SequencePad   int
+	// OnResult が指定されている場合、各ファイルの処理が終わるたびに、inputsでの位置iと結果を渡して呼び出します。
+	// 同時に複数回呼び出されることはありません。中断により処理されなかったファイルでは呼び出されません。
+	OnResult func(i int, r Result)
+	// OrderedResults が有効な場合、Workersが2以上でも、OnResultとOnProgressをinputsの順番で呼び出します。
+	// 前のファイルの処理が終わるまで、終わった後のファイルの呼び出しは待たされます。
+	OrderedResults bool
+	// OnProgress が指定されている場合、各ファイルの処理が終わるたびに、終わったファイル数doneと全体のファイル数total、
+	// 終わったファイルのパスを渡して呼び出します。中断により処理されなかったファイルも終わったものとして数えます。
+	// OnResultと同様に、同時に複数回呼び出されることはありません。
+	OnProgress func(done, total int, current string)
+
+	decodes decodeLimiter
+	// colorInfo はKeepColorChunksで入力から読み込んだチャンクです。ResizeImageContextが設定します。
+	colorInfo *pngColorInfo
+	// exifThumbnail はExifThumbnailで、入力にサムネイルがあったため出力のJPEGにサムネイルを入れるかどうかです。ResizeImageContextが設定します。
+	exifThumbnail bool
+}
+
+// ResizeImage はsrcPathの画像をoptに従ってリサイズし、出力先に書き出します。
+func ResizeImage(srcPath string, opt Options) (*Result, error) {
+	return ResizeImageContext(context.Background(), srcPath, opt)
+}
+
+// ResizeImageContext はResizeImageと同じ処理を行います。ctxがキャンセルされた場合は、
+// 読み込み中または各処理の区切りで中断し、出力ファイルを作らずにctxのエラーを返します。
+func ResizeImageContext(ctx context.Context, srcPath string, opt Options) (*Result, error) {
+	// replaceでは入力ファイルが出力に置き換わるため、入力のバイト数は処理の前に取得しておく。
+	srcBytes := fileSize(srcPath)
+	r, err := resizeFile(ctx, srcPath, opt)
+	if r != nil {
+		r.SourceBytes = srcBytes
+	}
+	return r, err
+}
+
+// fileSize はファイルのバイト数を返します。取得できない場合は0です。
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// resizeFile はResizeImageContextの処理の本体です。
+func resizeFile(ctx context.Context, srcPath string, opt Options) (*Result, error) {
+	if opt.Replace && (opt.ICO || opt.Tile > 0) {
+		return nil, errors.New("replace cannot be combined with ico or tile output")
+	}
+
+	// 間引けないGIF, WebPのアニメーションや静止画を、黙って最初のフレームだけにしないようデコードする前に弾く。
+	if opt.FrameStep > 1 && (!keepsAnimation(opt) || !isAPNG(srcPath)) {
+		return nil, ErrNotAnimated
+	}
+
+	// しきい値以下の画像は、デコードする前に対象から外す。
+	if opt.OnlyLargerThanBytes > 0 || opt.OnlyWiderThan > 0 {
+		exceeds, err := exceedsThreshold(srcPath, opt)
+		if err != nil {
+			return nil, err
+		}
+		if !exceeds && opt.CopySkipped {
+			return copySource(ctx, srcPath, opt)
+		} else if !exceeds {
+			return nil, ErrBelowThreshold
+		}
+	}
+
+	// 元のサイズの画像を保持するのは縮小が終わるまでなので、その間だけ同時にデコードする数の枠を確保する。
+	release, err := opt.decodes.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	imgSrc, cfg, t, err := decodeImage(ctx, srcPath, opt)
+	if opt.CopyUnsupported && (errors.Is(err, ErrUnsupportedFormat) || errors.Is(err, ErrInvalidImage)) {
+		release()
+		return copySource(ctx, srcPath, opt)
+	} else if err != nil {
+		return nil, err
+	}
+
+	if opt.KeepColorChunks && t == TYPE_PNG {
+		info, err := readPNGColorInfo(srcPath)
+		if err != nil {
+			return nil, err
+		}
+		if len(info.chunks) > 0 {
+			opt.colorInfo = info
+		}
+	}
+
+	if opt.ExifThumbnail {
+		if info, err := readExifFile(srcPath, t); err == nil {
+			opt.exifThumbnail = info.Thumbnail
+		}
+	}
+
+	// 日付ごとに振り分ける場合は、出力先をOutputDir/YYYY/MMにする。
+	if opt.OrganizeByDate {
+		if opt.OutputDir == "" {
+			opt.OutputDir, opt.PreserveStructure = filepath.Dir(srcPath), false
+		}
+		opt.OutputDir = filepath.Join(opt.OutputDir, dateDir(srcPath, t, opt))
+	}
+
+	// パレット形式はインデックスではなく色で補間されるよう、縮小の前にフルカラーに変換する。
+	// ディザリングで元のパレットを使うため、imgSrcはそのまま残す。
+	scaleSrc := imgSrc
+	if _, ok := imgSrc.(*image.YCbCr); !ok || !opt.StripScale {
+		scaleSrc = fullColor(imgSrc)
+	}
+	scaleSrc = autoOrient(scaleSrc, srcPath, t, opt)
+
+	// rectange of image
+	rctSrc := sourceRect(scaleSrc, opt)
+
+	// ICOはサイズの指定によらず、ファビコンの各サイズを1ファイルにまとめて出力する。
+	if opt.ICO {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		dst, err := createOutput(ctx, srcPath, outName(srcPath, opt.Suffix, ".ico", opt), opt)
+		if err != nil {
+			return nil, err
+		}
+		defer dst.Close()
+		if err := writeICO(dst, icoImages(scaleSrc, rctSrc, opt)); err != nil {
+			return nil, err
+		}
+		if err := dst.Commit(); err != nil {
+			return nil, err
+		}
+		if opt.VerifyOutput && opt.NewOutput == nil {
+			if err := verifyICO(dst.Name()); err != nil {
+				return nil, err
+			}
+		}
+		size := ICOSizes[len(ICOSizes)-1]
+		return newResult(srcPath, dst.Name(), cfg, size, size, "ico", opt), nil
+	}
+
+	if len(opt.Srcset) > 0 {
+		return resizeSrcset(ctx, srcPath, imgSrc, scaleSrc, rctSrc, cfg, t, opt)
+	}
+	return resizeDecoded(ctx, srcPath, imgSrc, scaleSrc, rctSrc, cfg, t, release, opt)
+}
+
+// resizeDecoded は読み込んだ画像imgSrc(向きを直したものがscaleSrc)のrctSrcの範囲をoptに従ってリサイズし、書き出します。
+// releaseは元のサイズの画像が要らなくなった時点で呼び出します。
+func resizeDecoded(ctx context.Context, srcPath string, imgSrc, scaleSrc image.Image, rctSrc image.Rectangle, cfg image.Config, t string, release func(), opt Options) (*Result, error) {
+	newW, newH, warnings, err := targetSize(rctSrc, opt)
+	if err != nil {
+		return nil, err
+	}
+	suffix := opt.Suffix
+	if opt.DimSuffix {
+		opt.Suffix = suffix + dimensionSuffix(newW, newH, opt)
+	}
+
+	// アニメーションPNGをPNGで出力する場合は、すべてのフレームをリサイズしてアニメーションのまま出力する。
+	// それ以外の形式やタイル分割では、最初のフレーム(既定の画像)だけを静止画として出力する。
+	if t == TYPE_PNG && keepsAnimation(opt) && isAPNG(srcPath) {
+		return resizeAPNG(ctx, srcPath, cfg, rctSrc, newW, newH, warnings, opt)
+	}
+
+	// 大きく縮小する場合は、先に高速な方法で縮小後のサイズの数倍まで縮小しておく。
+	if opt.FastHuge {
+		scaleSrc, rctSrc = prescale(scaleSrc, rctSrc, newW, newH)
+	}
+
+	imgDst := newCanvas(imgSrc, image.Rect(0, 0, newW, newH))
+	if k, ok := scalerFor(opt).(*draw.Kernel); ok && opt.StripScale && newW < rctSrc.Dx() && newH < rctSrc.Dy() {
+		scaleStrips(imgDst, scaleSrc, rctSrc, k)
+	} else {
+		scalerFor(opt).Scale(imgDst, imgDst.Bounds(), fullColor(scaleSrc), rctSrc, draw.Over, nil)
+	}
+	// 比較画像の元の画像側は、元のサイズの画像を手放す前に縮小しておく。
+	var before image.Image
+	if opt.Preview != "" {
+		before = previewReference(scaleSrc, rctSrc, newW, newH)
+	}
+	release()
+
+	finishImage(imgDst, opt)
+
+	if opt.Pow2 {
+		imgDst = padToPow2(imgDst, opt.Background)
+		newW, newH = imgDst.Bounds().Dx(), imgDst.Bounds().Dy()
+	}
+	if opt.BackgroundImage != nil {
+		imgDst = overBackground(imgDst, fitBackground(opt.BackgroundImage, imgDst.Bounds(), opt))
+	}
+	imgDst = to8bit(imgDst, imgSrc)
+
+	outType := t
+	if opt.OutFormat != "" {
+		outType = opt.OutFormat
+	}
+	if outType == FORMAT_AUTO_SMART {
+		outType = smartFormat(imgDst, opt)
+	}
+	// 円形切り抜きは透過が必要なため、JPEGの場合は出力形式をPNGにする。
+	if opt.Circle && outType == TYPE_JPG {
+		outType = TYPE_PNG
+	}
+	// 置き換える場合は拡張子と内容が食い違わないよう、入力と同じ形式でしか出力しない。
+	if opt.Replace && outType != t {
+		return nil, fmt.Errorf("cannot replace %s source with %s output", t, outType)
+	}
+
+	var imgOut image.Image = imgDst
+	if opt.Dither {
+		if p, ok := imgSrc.(*image.Paletted); ok && outType == TYPE_PNG {
+			imgOut = ditherImage(imgDst, p.Palette)
+		} else if isHighBitDepth(imgSrc) {
+			imgOut = ditherImage(imgDst, nil)
+		}
+	}
+
+	if opt.ColorModel != "" {
+		if err := CheckColorModel(opt.ColorModel, outType); err != nil {
+			return nil, err
+		}
+		imgOut = convertColorModel(imgOut, opt.ColorModel, opt.Background)
+	} else if isGraySource(imgSrc) && isNeutral(imgOut) {
+		// グレースケールの入力は、背景色などで色や透過が付かない限りグレースケールのまま出力する。
+		imgOut = convertColorModel(imgOut, COLOR_GRAY, nil)
+	}
+
+	// 縮小処理に時間がかかった場合、書き出しを始める前に中断する。
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if opt.SSIM > 0 && usesQuality(outType, opt) {
+		if opt.Quality, err = searchQuality(imgOut, outType, opt); err != nil {
+			return nil, err
+		}
+	}
+
+	// 出力の大きさに上限がある場合は、収まるまで品質、次に幅・高さを下げる。エンコード結果はそのまま書き出す。
+	var encoded []byte
+	if opt.MaxOutputBytes > 0 {
+		fitted, data, q, err := fitOutputBytes(imgOut, outType, opt)
+		if err != nil {
+			return nil, err
+		}
+		if q != 0 && q != qualityFor(outType, opt) {
+			warnings = append(warnings, fmt.Sprintf("quality lowered to %d to fit within %d bytes", q, opt.MaxOutputBytes))
+			opt.Quality, opt.FormatQuality = q, nil
+		}
+		if b := fitted.Bounds(); b.Dx() != newW || b.Dy() != newH {
+			warnings = append(warnings, fmt.Sprintf("resized to %dx%d to fit within %d bytes", b.Dx(), b.Dy(), opt.MaxOutputBytes))
+			newW, newH = b.Dx(), b.Dy()
+			if opt.DimSuffix {
+				opt.Suffix = suffix + dimensionSuffix(newW, newH, opt)
+			}
+		}
+		imgOut, encoded = fitted, data
+	}
+
+	var preview string
+	if before != nil {
+		if preview, err = writePreview(ctx, before, imgOut, srcPath, opt); err != nil {
+			return nil, err
+		}
+	}
+
+	// 出力形式によって拡張子が決まるため、smallestの場合は先にメモリ上でエンコードする。
+	// ファイル名をハッシュにする場合も、エンコード後のバイト列から名前を決めるため同様にする。
+	if outType == FORMAT_SMALLEST {
+		if outType, encoded, opt.Quality, err = encodeSmallest(imgOut, opt); err != nil {
+			return nil, err
+		}
+	} else if opt.HashName && encoded == nil {
+		var buf bytes.Buffer
+		if err := encodeImage(&buf, imgOut, outType, opt); err != nil {
+			return nil, err
+		}
+		encoded = buf.Bytes()
+	}
+
+	// 入力ファイルの拡張子(.JPEG, .jpe, .JPGなど)によらず、出力形式の標準の拡張子にする。
+	ext := extensions[outType]
+	outFile := outName(srcPath, opt.Suffix, ext, opt)
+	if opt.HashName {
+		outFile = contentHashName(encoded) + ext
+	}
+
+	// タイル分割時は1枚の画像としては書き出さず、タイルごとのファイルにする。
+	if opt.Tile > 0 {
+		tiles, err := writeTiles(ctx, imgOut, srcPath, ext, outType, opt)
+		if err != nil {
+			return nil, err
+		}
+		result := newResult(srcPath, filepath.Join(outputDirFor(srcPath, opt), outFile), cfg, newW, newH, outType, opt)
+		result.Tiles = tiles
+		result.Preview = preview
+		result.Warnings = warnings
+		return result, nil
+	}
+
+	var dst OutputWriter
+	if opt.Replace {
+		dst, err = replaceOutput(ctx, srcPath, opt)
+	} else {
+		dst, err = createOutput(ctx, srcPath, outFile, opt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer dst.Close()
+
+	if encoded != nil {
+		if _, err := dst.Write(encoded); err != nil {
+			return nil, err
+		}
+	} else if err := encodeImage(dst, imgOut, outType, opt); err != nil {
+		return nil, err
+	}
+	if err := dst.Commit(); err != nil {
+		return nil, err
+	}
+	if opt.VerifyOutput && opt.NewOutput == nil {
+		if err := verifyOutput(dst.Name(), newW, newH); err != nil {
+			return nil, err
+		}
+	}
+	result := newResult(srcPath, dst.Name(), cfg, newW, newH, outType, opt)
+	result.Preview = preview
+	result.Warnings = warnings
+	return result, nil
+}
+
+// sourceRect は画像のうちリサイズに使う範囲を返します。
+func sourceRect(img image.Image, opt Options) image.Rectangle {
+	r := img.Bounds()
+	if opt.TrimTransparent {
+		r = opaqueBounds(img)
+	}
+	if opt.AspectWidth > 0 && opt.AspectHeight > 0 {
+		r = aspectCrop(r, opt.AspectWidth, opt.AspectHeight, opt.Gravity)
+	}
+	if opt.Square || opt.Circle {
+		r = centerSquare(r)
+	}
+	return r
+}
+
+// strictAspectTolerance はStrictAspectで、縦横比が元の画像と同じとみなす差の割合です。
+// 四捨五入による1pxの差は、この割合を超えても同じとみなします。
+const strictAspectTolerance = 0.01
+
+// targetSize はrctSrcの範囲をoptに従ってリサイズした後の幅と高さを返します。
+// 元の画像より大きくなる場合の警告はwarningsに入れて返します。
+func targetSize(rctSrc image.Rectangle, opt Options) (newW, newH int, warnings []string, err error) {
+	w, h := opt.Width, opt.Height
+	if w < SIZE_AUTO || h < SIZE_AUTO || (w == SIZE_AUTO && h < 1) || (h == SIZE_AUTO && w < 1) {
+		return 0, 0, nil, fmt.Errorf("%w: width %d and height %d (-1 derives one side from the other, which must be positive)", ErrInvalidDimensions, w, h)
+	}
+	if opt.ScaleX > 0 || opt.ScaleY > 0 {
+		// 縦横の倍率は独立に掛け、それぞれ四捨五入する。指定のない側は1倍とする。
+		sx, sy := opt.ScaleX, opt.ScaleY
+		if sx <= 0 {
+			sx = 1
+		}
+		if sy <= 0 {
+			sy = 1
+		}
+		newW = int(math.Round(float64(rctSrc.Dx()) * sx))
+		newH = int(math.Round(float64(rctSrc.Dy()) * sy))
+	} else if opt.Megapixels > 0 {
+		// 縦横比 r = W/H と面積 A から、幅 = √(A·r), 高さ = √(A/r) となる。
+		area := opt.Megapixels * 1_000_000
+		ratio := float64(rctSrc.Dx()) / float64(rctSrc.Dy())
+		newW = int(math.Round(math.Sqrt(area * ratio)))
+		newH = int(math.Round(math.Sqrt(area / ratio)))
+	} else if w > 0 && h > 0 && opt.KeepAspectRatio {
+		// 幅・高さの両方に収まる倍率のうち小さい方を使う。
+		scale := math.Min(float64(w)/float64(rctSrc.Dx()), float64(h)/float64(rctSrc.Dy()))
+		newW = int(math.Round(float64(rctSrc.Dx()) * scale))
+		newH = int(math.Round(float64(rctSrc.Dy()) * scale))
+	} else if w > 0 && h > 0 {
+		if opt.StrictAspect && !aspectMatches(rctSrc.Dx(), rctSrc.Dy(), w, h) {
+			return 0, 0, nil, fmt.Errorf("%w: %dx%d cannot be resized to %dx%d without distortion", ErrAspectMismatch, rctSrc.Dx(), rctSrc.Dy(), w, h)
+		}
+		newH = h
+		newW = w
+	} else if opt.AspectWidth > 0 && opt.AspectHeight > 0 && (w > 0 || h > 0) {
+		// 縦横比を指定した場合は、切り抜いた範囲の端数によらず指定した比からもう一方を計算する。
+		ratio := float64(opt.AspectWidth) / float64(opt.AspectHeight)
+		if w > 0 {
+			newW, newH = w, int(math.Round(float64(w)/ratio))
+		} else {
+			newW, newH = int(math.Round(float64(h)*ratio)), h
+		}
+	} else if h > 0 {
+		// 幅はSIZE_AUTOまたは指定なしのため、高さと元の縦横比から計算する。
+		newH = h
+		newW = int(math.Round(float64(rctSrc.Dx()) * float64(h) / float64(rctSrc.Dy())))
+	} else if w > 0 {
+		newW = w
+		newH = int(math.Round(float64(rctSrc.Dy()) * float64(w) / float64(rctSrc.Dx())))
+	} else if opt.AspectWidth > 0 && opt.AspectHeight > 0 {
+		// 縦横比だけを変える場合は、切り抜いた範囲をそのままの解像度で出力する。
+		newW, newH = rctSrc.Dx(), rctSrc.Dy()
+	}
+	// 細長い画像では、縦横比から計算した側が0pxになることがある。空の画像を出力しないよう1pxにする。
+	if newW > 0 || newH > 0 {
+		newW, newH = max(1, newW), max(1, newH)
+	}
+	if newW < 1 || newH < 1 {
+		return 0, 0, nil, fmt.Errorf("%w: cannot resize %dx%d to %dx%d (width or height must be given)", ErrInvalidDimensions, rctSrc.Dx(), rctSrc.Dy(), newW, newH)
+	}
+
+	// 意図しない拡大に気付けるよう、元より大きくなる場合は警告する。
+	if newW > rctSrc.Dx() || newH > rctSrc.Dy() {
+		if opt.NoUpscale {
+			// 縦横比を保ったまま、元のサイズに収まるまで小さくする。
+			scale := math.Min(float64(rctSrc.Dx())/float64(newW), float64(rctSrc.Dy())/float64(newH))
+			newW = max(1, int(math.Round(float64(newW)*scale)))
+			newH = max(1, int(math.Round(float64(newH)*scale)))
+		} else if !opt.AllowUpscale {
+			warnings = append(warnings, fmt.Sprintf("%dx%d is upscaled to %dx%d", rctSrc.Dx(), rctSrc.Dy(), newW, newH))
+		}
+	}
+
+	if opt.RoundTo > 1 {
+		newW = roundToMultiple(newW, opt.RoundTo, rctSrc.Dx(), opt.NoUpscale)
+		newH = roundToMultiple(newH, opt.RoundTo, rctSrc.Dy(), opt.NoUpscale)
+	}
+
+	return newW, newH, warnings, nil
+}
+
+// aspectMatches はw×hの縦横比がsrcW×srcHとstrictAspectToleranceの範囲で同じかどうかを返します。
+// 幅から計算した高さ、高さから計算した幅のどちらかが1px以内の場合も同じとみなします。
+func aspectMatches(srcW, srcH, w, h int) bool {
+	exactH := float64(w) * float64(srcH) / float64(srcW)
+	exactW := float64(h) * float64(srcW) / float64(srcH)
+	if math.Abs(float64(h)-exactH) <= 1 || math.Abs(float64(w)-exactW) <= 1 {
+		return true
+	}
+	return math.Abs(float64(h)/exactH-1) <= strictAspectTolerance
+}
+
+// roundToMultiple はvをnの倍数のうち最も近いものに丸めます。nより小さくはしません。
+// noUpscaleが有効で丸めた結果がsrcを超える場合は、src以下の倍数に切り捨てます。
+func roundToMultiple(v, n, src int, noUpscale bool) int {
+	r := max(n, (v+n/2)/n*n)
+	if noUpscale && r > src && src >= n {
+		r = src / n * n
+	}
+	return r
+}
+
+// decodeImage はsrcPathの画像を読み込み、画像と画像の情報、形式(TYPE_JPG, TYPE_PNG)を返します。
+// 対応していない形式やopt.MaxPixelsを超える画像は、画像全体を展開する前にエラーにします。
+func decodeImage(ctx context.Context, srcPath string, opt Options) (image.Image, image.Config, string, error) {
+	// 画像ファイルを開く
+	f, err := os.Open(srcPath)
+	if err != nil {
+		return nil, image.Config{}, "", err
+	}
+	defer f.Close()
+	src := &ctxReader{ctx: ctx, r: f}
+
+	// image.Decodeのunexpected EOF対策
+	imgHeader := bytes.NewBuffer(nil)
+	r := io.TeeReader(src, imgHeader)
+
+	cfg, t, err := image.DecodeConfig(r)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, image.Config{}, "", ctxErr
+	} else if errors.Is(err, image.ErrFormat) {
+		return nil, image.Config{}, "", unknownFormatError(imgHeader.Bytes())
+	} else if err != nil {
+		return nil, image.Config{}, "", fmt.Errorf("%w: %w", ErrDecode, err)
+	}
+
+	// ヘッダ上のサイズだけを見て、巨大な画像を展開してメモリを使い切る前に弾く。
+	if pixels := int64(cfg.Width) * int64(cfg.Height); opt.MaxPixels > 0 && pixels > opt.MaxPixels {
+		return nil, image.Config{}, "", fmt.Errorf("%w: %dx%d exceeds %d pixels", ErrTooLarge, cfg.Width, cfg.Height, opt.MaxPixels)
+	}
+
+	if t != TYPE_JPG && t != TYPE_PNG {
+		return nil, image.Config{}, "", fmt.Errorf("%w: This method only run jpeg and png", ErrUnsupportedFormat)
+	}
+
+	var img image.Image
+	mReader := io.MultiReader(imgHeader, src)
+	if t == TYPE_JPG {
+		img, err = jpeg.Decode(mReader)
+	} else {
+		img, err = png.Decode(mReader)
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, image.Config{}, "", ctxErr
+	} else if err != nil {
+		return nil, image.Config{}, "", fmt.Errorf("%w: %w", ErrDecode, err)
+	}
+	return img, cfg, t, nil
+}
+
+// finishImage は縮小後の画像にOptionsで指定された補正・切り抜きを適用します。
+func finishImage(img draw.RGBA64Image, opt Options) {
+	if opt.Normalize {
+		normalizeLevels(img)
+	}
+	if opt.Circle {
+		applyCircleMask(img)
+	}
+}
+
+// newCanvas はsrcの縮小先となる画像を作成します。16bitの入力は8bitに落とさずに補間するため、
+// *image.RGBA64に縮小し、出力時に一度だけ量子化します(PNGの場合は16bitのまま出力されます)。
+// 透過のある8bitの入力も*image.RGBA64に縮小します。補間はアルファを乗算済みの値で行うため、
+// 8bitのまま保持すると半透明の縁で色の精度が落ち、縁の色がずれたり暗くなったりするためです。出力前にto8bitで8bitに戻します。
+func newCanvas(src image.Image, r image.Rectangle) draw.RGBA64Image {
+	if isHighBitDepth(src) || !isOpaque(src) {
+		return image.NewRGBA64(r)
+	}
+	return image.NewRGBA(r)
+}
+
+// to8bit は8bitの入力srcを透過のため*image.RGBA64で処理したimgを、アルファを乗算しない*image.NRGBAに変換します。
+// 16bitの入力やsrcが不透明な場合はimgをそのまま返します。
+func to8bit(img draw.RGBA64Image, src image.Image) draw.RGBA64Image {
+	if _, ok := img.(*image.RGBA64); !ok || isHighBitDepth(src) {
+		return img
+	}
+	dst := image.NewNRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Src)
+	return dst
+}
+
+// fullColor はパレット形式の画像と、色差がサブサンプリングされたYCbCrの画像を*image.RGBAに変換して返します。
+// それ以外の画像はそのまま返します。
+func fullColor(img image.Image) image.Image {
+	if ycc, ok := img.(*image.YCbCr); ok && ycc.SubsampleRatio != image.YCbCrSubsampleRatio444 {
+		return upsampleYCbCr(ycc)
+	}
+	p, ok := img.(*image.Paletted)
+	if !ok {
+		return img
+	}
+	rgba := image.NewRGBA(p.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), p, p.Bounds().Min, draw.Src)
+	return rgba
+}
+
+// isHighBitDepth は画像が1チャンネルあたり8bitより多い精度を持つかどうかを返します。
+func isHighBitDepth(img image.Image) bool {
+	switch img.(type) {
+	case *image.RGBA64, *image.NRGBA64, *image.Gray16:
+		return true
+	}
+	return false
+}
+
+// outName はsrcPathの出力ファイル名として、入力ファイル名の拡張子を除いた部分にsuffixとextを付けたものを返します。
+// extは出力する形式のextensionsの値で、入力の拡張子(.jpeg, .jfifなど)は引き継ぎません。
+// opt.OutNameが指定されている場合は入力ファイル名の代わりにOutNameを使います。
+func outName(srcPath, suffix, ext string, opt Options) string {
+	stem := opt.OutName
+	if stem == "" {
+		fileName := filepath.Base(srcPath)
+		stem = strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	}
+	return stem + suffix + ext
+}
+
+// outputDirFor はsrcPathの出力先ディレクトリを返します。opt.OutputDirが空の場合はsrcPathと同じディレクトリです。
+// opt.PreserveStructureが有効でsrcPathがopt.BaseDirの下にある場合は、BaseDirからの相対的なディレクトリ構成をOutputDirの下に再現します。
+func outputDirFor(srcPath string, opt Options) string {
+	if opt.OutputDir == "" {
+		return filepath.Dir(srcPath)
+	}
+	if !opt.PreserveStructure || opt.BaseDir == "" {
+		return opt.OutputDir
+	}
+	rel, err := filepath.Rel(opt.BaseDir, filepath.Dir(srcPath))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return opt.OutputDir
+	}
+	return filepath.Join(opt.OutputDir, rel)
+}
+
+// createOutput は出力用ディレクトリを必要に応じて作成し、srcPathの出力としてoutFileを書き込むためのファイルを返します。
+// 書き込みは一時ファイルに行われ、CommitするまでoutFileは作られません(既にある場合は元の内容のまま残ります)。
+// opt.NewOutputが指定されている場合は、ディレクトリを作成せずにopt.NewOutputが返す書き込み先を返します。
+// ctxがキャンセルされた後は書き込みもCommitもできず、ctxのエラーになります。
+func createOutput(ctx context.Context, srcPath, outFile string, opt Options) (OutputWriter, error) {
+	outputDir := outputDirFor(srcPath, opt)
+	outPath := filepath.Join(outputDir, outFile)
+	if runtime.GOOS == "windows" && isWindowsReservedName(outFile) {
+		return nil, fmt.Errorf("%q is a reserved file name on Windows", outFile)
+	}
+	if abs, err := filepath.Abs(outPath); err == nil && opt.ProtectedPaths[abs] {
+		return nil, fmt.Errorf("%w: %s", ErrOverwriteInput, outPath)
+	}
+	if opt.NewOutput != nil {
+		w, err := opt.NewOutput(outPath)
+		if err != nil {
+			return nil, err
+		}
+		return withContext(ctx, w), nil
+	}
+
+	if fi, err := os.Stat(outputDir); err == nil && !fi.IsDir() {
+		// ファイルの下には作れないため、わかりにくいエラーになる前に止める。
+		return nil, fmt.Errorf("%w: %s", ErrOutputNotDir, outputDir)
+	} else if err != nil {
+		// 出力用ディレクトリが存在しないため、作成する。
+		perm := os.FileMode(0755)
+		if opt.MirrorPerms {
+			srcDir, statErr := os.Stat(filepath.Dir(srcPath))
+			if statErr != nil {
+				return nil, statErr
+			}
+			perm = srcDir.Mode().Perm()
+		}
+		if dirErr := os.MkdirAll(outputDir, perm); dirErr != nil {
+			return nil, dirErr
+		}
+		// Mkdirはumaskの影響を受けるため、元のディレクトリと同じになるよう設定し直す。
+		if opt.MirrorPerms {
+			if chmodErr := os.Chmod(outputDir, perm); chmodErr != nil {
+				return nil, chmodErr
+			}
+		}
+	}
+
+	f, err := createAtomic(outPath, opt.TmpDir)
+	if err != nil {
+		return nil, err
+	}
+	return withContext(ctx, f), nil
+}
+
+// extensions は出力形式ごとの拡張子です。出力ファイルには入力ファイルの拡張子ではなく、常にこの拡張子を付けます。
+var extensions = map[string]string{
+	TYPE_JPG:  ".jpg",
+	TYPE_PNG:  ".png",
+	TYPE_WEBP: ".webp",
+}
+
+// Extension はformat(TYPE_JPG, TYPE_PNG, TYPE_WEBP)の出力ファイルの拡張子を返します。それ以外の形式ではfalseを返します。
+func Extension(format string) (string, bool) {
+	ext, ok := extensions[format]
+	return ext, ok
+}
+
+// encodeImage は画像をformatの形式でwに書き出します。
+func encodeImage(w io.Writer, img image.Image, format string, opt Options) error {
+	if opt.exifThumbnail && format == TYPE_JPG {
+		var buf bytes.Buffer
+		noThumbnail := opt
+		noThumbnail.exifThumbnail = false
+		if err := encodeImage(&buf, img, format, noThumbnail); err != nil {
+			return err
+		}
+		data, err := addExifThumbnail(buf.Bytes(), img)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+	if opt.colorInfo != nil && format == TYPE_PNG {
+		var buf bytes.Buffer
+		noChunks := opt
+		noChunks.colorInfo = nil
+		if err := encodeImage(&buf, img, format, noChunks); err != nil {
+			return err
+		}
+		data, err := addColorChunks(buf.Bytes(), opt.colorInfo)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+	if opt.Comment != "" && format != TYPE_WEBP {
+		var buf bytes.Buffer
+		noComment := opt
+		noComment.Comment = ""
+		if err := encodeImage(&buf, img, format, noComment); err != nil {
+			return err
+		}
+		data, err := addComment(buf.Bytes(), format, opt.Comment)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+
+	quality := qualityFor(format, opt)
+	switch format {
+	case TYPE_JPG:
+		return encodeJPEG(w, img, quality, opt.ChromaSubsampling)
+	case TYPE_PNG:
+		enc := png.Encoder{CompressionLevel: pngCompressionLevels[opt.PNGCompression]}
+		return enc.Encode(w, img)
+	case TYPE_WEBP:
+		// エンコーダは*image.RGBAの画素をアルファを乗算していない値として読むため、
+		// 透過のある*image.RGBA(circleで切り抜いた画像など)は*image.NRGBAに変換して渡す。
+		if rgba, ok := img.(*image.RGBA); ok && !rgba.Opaque() {
+			nrgba := image.NewNRGBA(rgba.Bounds())
+			draw.Draw(nrgba, nrgba.Bounds(), rgba, rgba.Bounds().Min, draw.Src)
+			img = nrgba
+		}
+		// 可逆圧縮では透明部分の色も含めて画素をそのまま残す。
+		return webp.Encode(w, img, webp.Options{Quality: quality, Lossless: opt.WebPLossless, Exact: opt.WebPLossless})
+	}
+	return fmt.Errorf("%w: cannot encode %s", ErrUnsupportedFormat, format)
+}
+
+// centerSquare は矩形の中央から短辺を一辺とする正方形を切り出します。
+func centerSquare(r image.Rectangle) image.Rectangle {
+	size := r.Dx()
+	if r.Dy() < size {
+		size = r.Dy()
+	}
+	x0 := r.Min.X + (r.Dx()-size)/2
+	y0 := r.Min.Y + (r.Dy()-size)/2
+	return image.Rect(x0, y0, x0+size, y0+size)
+}
+
+// applyCircleMask は画像に内接する円の外側を透過させます。縁は1pxでアンチエイリアスします。
+func applyCircleMask(img draw.RGBA64Image) {
+	b := img.Bounds()
+	cx := float64(b.Min.X) + float64(b.Dx())/2
+	cy := float64(b.Min.Y) + float64(b.Dy())/2
+	radius := math.Min(float64(b.Dx()), float64(b.Dy())) / 2
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			d := math.Hypot(float64(x)+0.5-cx, float64(y)+0.5-cy)
+			cover := math.Max(0, math.Min(1, radius-d+0.5))
+			if cover >= 1 {
+				continue
+			}
+			// アルファ乗算済みなので全チャンネルに掛ける。
+			c := img.RGBA64At(x, y)
+			img.SetRGBA64(x, y, color.RGBA64{
+				R: uint16(float64(c.R) * cover),
+				G: uint16(float64(c.G) * cover),
+				B: uint16(float64(c.B) * cover),
+				A: uint16(float64(c.A) * cover),
+			})
+		}
+	}
+}
+
+// normalizeLevels はRGBの各チャンネルについて最小値・最大値を求め、最小〜最大の範囲に線形に引き伸ばします。
+// 既に最小値・最大値を使い切っているチャンネルは変化しません。
+func normalizeLevels(img draw.RGBA64Image) {
+	const full = 0xffff
+	b := img.Bounds()
+	lo := [3]uint32{full, full, full}
+	hi := [3]uint32{0, 0, 0}
+	// アルファ乗算済みの値では半透明部分が暗く数えられるため、乗算前の値で集計する。
+	each := func(fn func(x, y int, a uint32, c *[3]uint32)) {
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				p := img.RGBA64At(x, y)
+				a := uint32(p.A)
+				if a == 0 {
+					continue
+				}
+				c := [3]uint32{uint32(p.R) * full / a, uint32(p.G) * full / a, uint32(p.B) * full / a}
+				fn(x, y, a, &c)
+			}
+		}
+	}
+	each(func(_, _ int, _ uint32, c *[3]uint32) {
+		for ch := 0; ch < 3; ch++ {
+			lo[ch] = min(lo[ch], c[ch])
+			hi[ch] = max(hi[ch], c[ch])
+		}
+	})
+
+	var stretch [3]bool
+	for ch := 0; ch < 3; ch++ {
+		stretch[ch] = hi[ch] > lo[ch] && (lo[ch] > 0 || hi[ch] < full)
+	}
+	if !stretch[0] && !stretch[1] && !stretch[2] {
+		return
+	}
+	each(func(x, y int, a uint32, c *[3]uint32) {
+		p := img.RGBA64At(x, y)
+		out := [3]*uint16{&p.R, &p.G, &p.B}
+		for ch := 0; ch < 3; ch++ {
+			if stretch[ch] {
+				v := (c[ch] - lo[ch]) * full / (hi[ch] - lo[ch])
+				*out[ch] = uint16(v * a / full)
+			}
+		}
+		img.SetRGBA64(x, y, p)
+	})
+}
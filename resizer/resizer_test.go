@@ -0,0 +1,543 @@
+package resizer
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"testing"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+func TestWebPLosslessRoundTrip(t *testing.T) {
+	translucent := image.NewNRGBA(image.Rect(0, 0, 16, 16))
+	for i := range translucent.Pix {
+		translucent.Pix[i] = uint8(i * 7)
+	}
+	tests := []struct {
+		name string
+		img  draw.Image
+	}{
+		{"opaque", gradient(16, 16)},
+		{"translucent", translucent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := encodeImage(&buf, tt.img, TYPE_WEBP, Options{WebPLossless: true}); err != nil {
+				t.Fatal(err)
+			}
+			got, err := webp.Decode(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := tt.img.Bounds()
+			if got.Bounds() != b {
+				t.Fatalf("bounds = %v, want %v", got.Bounds(), b)
+			}
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					want := color.NRGBAModel.Convert(tt.img.At(x, y))
+					if c := color.NRGBAModel.Convert(got.At(x, y)); c != want {
+						t.Fatalf("pixel (%d,%d) = %v, want %v", x, y, c, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+// redLevels はimgのy行目の赤の値が何段階あるかを返します。
+func redLevels(img image.Image, y int) int {
+	levels := map[uint32]bool{}
+	b := img.Bounds()
+	for x := b.Min.X; x < b.Max.X; x++ {
+		r, _, _, _ := img.At(x, y).RGBA()
+		levels[r] = true
+	}
+	return len(levels)
+}
+
+func TestHighBitDepthBanding(t *testing.T) {
+	tests := []struct {
+		name       string
+		from, step int
+	}{
+		{"dark", 2000, 4},
+		{"mid", 20000, 4},
+		{"bright", 60000, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := image.NewRGBA64(image.Rect(0, 0, 1024, 4))
+			for y := 0; y < 4; y++ {
+				for x := 0; x < 1024; x++ {
+					v := uint16(tt.from + x*tt.step)
+					src.SetRGBA64(x, y, color.RGBA64{v, v, v, 0xffff})
+				}
+			}
+			dir := t.TempDir()
+			p := writePNG(t, dir, "g.png", src)
+			r, err := ResizeImage(p, Options{Width: 512, OutputDir: filepath.Join(dir, "out")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := decodeFile(t, r.OutputPath)
+
+			// 8bitに変換してから縮小した場合
+			src8 := image.NewRGBA(src.Bounds())
+			draw.Draw(src8, src8.Bounds(), src, image.Point{}, draw.Src)
+			naive := image.NewRGBA(image.Rect(0, 0, 512, 2))
+			xdraw.CatmullRom.Scale(naive, naive.Bounds(), src8, src8.Bounds(), draw.Src, nil)
+
+			gotLevels, naiveLevels := redLevels(got, 1), redLevels(naive, 1)
+			if gotLevels < 4*naiveLevels {
+				t.Errorf("output has %d levels, want at least 4x the %d levels of the 8-bit path", gotLevels, naiveLevels)
+			}
+		})
+	}
+}
+
+func TestPalettedInterpolatesColors(t *testing.T) {
+	red, green, blue := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 255, 0, 255}, color.RGBA{0, 0, 255, 255}
+	tests := []struct {
+		name  string
+		width int
+	}{
+		{"upscale", 31},
+		{"downscale", 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// 左半分が赤、右半分が青で、パレットの間に緑がある。添字で補間すると境目が緑になる。
+			img := image.NewPaletted(image.Rect(0, 0, 16, 4), color.Palette{red, green, blue})
+			for y := 0; y < 4; y++ {
+				for x := 8; x < 16; x++ {
+					img.SetColorIndex(x, y, 2)
+				}
+			}
+			dir := t.TempDir()
+			src := writePNG(t, dir, "p.png", img)
+			r, err := ResizeImage(src, Options{Width: tt.width, Height: 4, AllowUpscale: true, OutputDir: filepath.Join(dir, "out")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, _ := decodeFile(t, r.OutputPath)
+			w := out.Bounds().Dx()
+			for x := 0; x < w; x++ {
+				c := color.RGBAModel.Convert(out.At(x, 1)).(color.RGBA)
+				if c.G > 8 {
+					t.Errorf("pixel %d = %v has green from the palette index", x, c)
+				}
+			}
+			left := color.RGBAModel.Convert(out.At(0, 1)).(color.RGBA)
+			right := color.RGBAModel.Convert(out.At(w-1, 1)).(color.RGBA)
+			mid := color.RGBAModel.Convert(out.At(w/2, 1)).(color.RGBA)
+			if left.R < 200 || right.B < 200 {
+				t.Errorf("edges = %v, %v, want red and blue", left, right)
+			}
+			if mid.R < 64 || mid.B < 64 {
+				t.Errorf("center pixel = %v, want a red/blue mix", mid)
+			}
+		})
+	}
+}
+
+func TestOutputExtensionIsNormalized(t *testing.T) {
+	tests := []struct {
+		ext, format, want string
+	}{
+		{".jpg", "", "a_x.jpg"},
+		{".JPG", "", "a_x.jpg"},
+		{".jpeg", "", "a_x.jpg"},
+		{".JPEG", "", "a_x.jpg"},
+		{".jpe", "", "a_x.jpg"},
+		{".JPE", "", "a_x.jpg"},
+		{".JPEG", TYPE_PNG, "a_x.png"},
+		{".jpe", TYPE_WEBP, "a_x.webp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ext+"/"+tt.format, func(t *testing.T) {
+			dir := t.TempDir()
+			src := writeJPEG(t, dir, "a"+tt.ext, gradient(40, 30))
+			r, err := ResizeImage(src, Options{Width: 10, Suffix: "_x", OutFormat: tt.format, OutputDir: filepath.Join(dir, "out")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := filepath.Base(r.OutputPath); got != tt.want {
+				t.Errorf("output name = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTargetSizeScaleXY(t *testing.T) {
+	tests := []struct {
+		name         string
+		srcW, srcH   int
+		sx, sy       float64
+		width        int
+		wantW, wantH int
+	}{
+		{"anamorphic", 400, 300, 1, 0.8, 0, 400, 240},
+		{"only x", 400, 300, 0.5, 0, 0, 200, 300},
+		{"only y", 400, 300, 0, 1.5, 0, 400, 450},
+		{"rounds half up", 101, 99, 0.5, 0.5, 0, 51, 50},
+		{"rounds down", 333, 333, 0.1, 0.1, 0, 33, 33},
+		{"overrides width", 400, 300, 0.25, 0.25, 300, 100, 75},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opt := Options{ScaleX: tt.sx, ScaleY: tt.sy, Width: tt.width, AllowUpscale: true}
+			w, h, _, err := targetSize(image.Rect(0, 0, tt.srcW, tt.srcH), opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if w != tt.wantW || h != tt.wantH {
+				t.Errorf("targetSize = %dx%d, want %dx%d", w, h, tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
+
+func TestResizeScaleXY(t *testing.T) {
+	dir := t.TempDir()
+	src := writeJPEG(t, dir, "a.jpg", gradient(400, 300))
+	r, err := ResizeImage(src, Options{ScaleX: 1, ScaleY: 0.8, OutputDir: filepath.Join(dir, "out")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, _ := decodeFile(t, r.OutputPath)
+	if out.Bounds() != image.Rect(0, 0, 400, 240) {
+		t.Errorf("output is %v, want 400x240", out.Bounds())
+	}
+}
+
+func TestTransparentEdgeHasNoFringe(t *testing.T) {
+	orange := color.NRGBA{200, 120, 40, 255}
+	hard := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	soft := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 29; x++ {
+			hard.SetNRGBA(x, y, orange)
+			soft.SetNRGBA(x, y, orange)
+		}
+		for x := 29; x < 64; x++ {
+			soft.SetNRGBA(x, y, color.NRGBA{orange.R, orange.G, orange.B, uint8(max(0, 40-(x-29)*2))})
+		}
+	}
+	tests := []struct {
+		name          string
+		src           image.Image
+		interpolation string
+		width         int
+	}{
+		{"hard catmullrom", hard, "catmullrom", 23},
+		{"hard lanczos3", hard, "lanczos3", 16},
+		{"hard bilinear", hard, "bilinear", 7},
+		{"soft catmullrom", soft, "catmullrom", 16},
+		{"soft lanczos3", soft, "lanczos3", 23},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scaler, err := NewInterpolation(tt.interpolation)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dir := t.TempDir()
+			src := writePNG(t, dir, "e.png", tt.src)
+			r, err := ResizeImage(src, Options{Width: tt.width, Scaler: scaler, OutputDir: filepath.Join(dir, "out")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, _ := decodeFile(t, r.OutputPath)
+			// 透明な画素の黒を混ぜていなければ、見える画素は元の色のまま薄くなるだけで暗くはならない。
+			// Lanczosのリンギングで明るくなる分は縁取りではないため許す。
+			for x := 0; x < tt.width; x++ {
+				c := color.NRGBAModel.Convert(out.At(x, tt.width/2)).(color.NRGBA)
+				if c.A < 8 {
+					continue
+				}
+				if dark := max(int(orange.R)-int(c.R), int(orange.G)-int(c.G), int(orange.B)-int(c.B)); dark > 12 {
+					t.Errorf("pixel %d = %v is %d darker than %v", x, c, dark, orange)
+				}
+			}
+		})
+	}
+}
+
+func TestThinSourceKeepsOnePixel(t *testing.T) {
+	tests := []struct {
+		name         string
+		srcW, srcH   int
+		opt          Options
+		wantW, wantH int
+	}{
+		{"1000x1 to height 1", 1000, 1, Options{Height: 1}, 1000, 1},
+		{"1000x1 to width 100", 1000, 1, Options{Width: 100}, 100, 1},
+		{"1000x1 to width -1 height 1", 1000, 1, Options{Width: SIZE_AUTO, Height: 1}, 1000, 1},
+		{"1x1000 to height 100", 1, 1000, Options{Height: 100}, 1, 100},
+		{"1000x1 in 10x10", 1000, 1, Options{Width: 10, Height: 10, KeepAspectRatio: true}, 10, 1},
+		{"1000x1 scaled by 0.01", 1000, 1, Options{ScaleX: 0.01, ScaleY: 0.01}, 10, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := writePNG(t, dir, "thin.png", image.NewGray(image.Rect(0, 0, tt.srcW, tt.srcH)))
+			tt.opt.OutputDir = filepath.Join(dir, "out")
+			r, err := ResizeImage(src, tt.opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, _ := decodeFile(t, r.OutputPath)
+			want := image.Rect(0, 0, tt.wantW, tt.wantH)
+			if r.Width != tt.wantW || r.Height != tt.wantH || out.Bounds() != want {
+				t.Errorf("result %dx%d, file %v, want %v", r.Width, r.Height, out.Bounds(), want)
+			}
+		})
+	}
+}
+
+func TestTargetSizeRejectsEmpty(t *testing.T) {
+	if _, _, _, err := targetSize(image.Rect(0, 0, 1000, 1), Options{}); !errors.Is(err, ErrInvalidDimensions) {
+		t.Errorf("error = %v, want %v", err, ErrInvalidDimensions)
+	}
+}
+
+func TestRoundToMultiple(t *testing.T) {
+	tests := []struct {
+		v, n, src int
+		noUpscale bool
+		want      int
+	}{
+		{1067, 16, 5000, false, 1072},
+		{800, 16, 5000, false, 800},
+		{1000, 16, 5000, false, 1008},
+		{1067, 2, 5000, false, 1068},
+		{7, 16, 5000, false, 16},
+		{1067, 16, 1067, true, 1056},
+		{1067, 16, 1067, false, 1072},
+	}
+	for _, tt := range tests {
+		if got := roundToMultiple(tt.v, tt.n, tt.src, tt.noUpscale); got != tt.want {
+			t.Errorf("roundToMultiple(%d, %d, %d, %v) = %d, want %d", tt.v, tt.n, tt.src, tt.noUpscale, got, tt.want)
+		}
+	}
+}
+
+func TestRoundToComputedSize(t *testing.T) {
+	// 1600x1200を高さ800にすると、幅は1066.67を四捨五入した1067になる。
+	tests := []struct {
+		name         string
+		opt          Options
+		wantW, wantH int
+	}{
+		{"16", Options{Height: 800, RoundTo: 16}, 1072, 800},
+		{"2", Options{Height: 800, RoundTo: 2}, 1068, 800},
+		{"16 with both sides", Options{Width: 1067, Height: 800, RoundTo: 16}, 1072, 800},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, h, _, err := targetSize(image.Rect(0, 0, 1600, 1200), tt.opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if w != tt.wantW || h != tt.wantH {
+				t.Errorf("targetSize = %dx%d, want %dx%d", w, h, tt.wantW, tt.wantH)
+			}
+		})
+	}
+
+	dir := t.TempDir()
+	src := writeJPEG(t, dir, "a.jpg", gradient(1600, 1200))
+	r, err := ResizeImage(src, Options{Height: 800, RoundTo: 16, OutputDir: filepath.Join(dir, "out")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, _ := decodeFile(t, r.OutputPath); out.Bounds() != image.Rect(0, 0, 1072, 800) {
+		t.Errorf("output is %v, want 1072x800", out.Bounds())
+	}
+}
+
+func TestJFIFInputs(t *testing.T) {
+	tests := []struct {
+		ext, format      string
+		want, wantFormat string
+	}{
+		{".jfif", "", "a.jpg", "jpeg"},
+		{".JFIF", "", "a.jpg", "jpeg"},
+		{".jif", "", "a.jpg", "jpeg"},
+		{".jfif", TYPE_PNG, "a.png", "png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ext+"/"+tt.format, func(t *testing.T) {
+			dir := t.TempDir()
+			src := writeJPEG(t, dir, "a"+tt.ext, gradient(40, 30))
+			r, err := ResizeImage(src, Options{Width: 10, OutFormat: tt.format, OutputDir: filepath.Join(dir, "out")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := filepath.Base(r.OutputPath); got != tt.want {
+				t.Errorf("output name = %s, want %s", got, tt.want)
+			}
+			if _, format := decodeFile(t, r.OutputPath); format != tt.wantFormat {
+				t.Errorf("output is %s, want %s", format, tt.wantFormat)
+			}
+		})
+	}
+}
+
+func TestTargetSizeAuto(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		wantW, wantH  int
+		wantErr       bool
+	}{
+		{"auto width", SIZE_AUTO, 150, 200, 150, false},
+		{"auto height", 200, SIZE_AUTO, 200, 150, false},
+		{"zero width", 0, 150, 200, 150, false},
+		{"both given", 100, 100, 100, 100, false},
+		{"both auto", SIZE_AUTO, SIZE_AUTO, 0, 0, true},
+		{"auto with zero", SIZE_AUTO, 0, 0, 0, true},
+		{"zero with auto", 0, SIZE_AUTO, 0, 0, true},
+		{"below auto", -2, 150, 0, 0, true},
+		{"neither", 0, 0, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, h, _, err := targetSize(image.Rect(0, 0, 400, 300), Options{Width: tt.width, Height: tt.height})
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidDimensions) {
+					t.Errorf("error = %v, want %v", err, ErrInvalidDimensions)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if w != tt.wantW || h != tt.wantH {
+				t.Errorf("targetSize = %dx%d, want %dx%d", w, h, tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
+
+func TestOutputDirIsFile(t *testing.T) {
+	tests := []struct {
+		name string
+		// file は出力先の代わりに置くファイルの、dirからの相対パスです。
+		file string
+		opt  Options
+	}{
+		{"output dir", "out", Options{Width: 10}},
+		{"preserved subdirectory", "out/sub", Options{Width: 10, PreserveStructure: true}},
+		{"with tmp dir", "out", Options{Width: 10, TmpDir: "tmp"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(dir, "in", "sub"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			src := writeJPEG(t, filepath.Join(dir, "in", "sub"), "a.jpg", gradient(40, 30))
+			file := filepath.Join(dir, filepath.FromSlash(tt.file))
+			if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(file, []byte("keep"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			tt.opt.OutputDir, tt.opt.BaseDir = filepath.Join(dir, "out"), filepath.Join(dir, "in")
+			if tt.opt.TmpDir != "" {
+				tt.opt.TmpDir = filepath.Join(dir, tt.opt.TmpDir)
+			}
+
+			for _, r := range BatchResize([]string{src, src}, tt.opt) {
+				if !errors.Is(r.Err, ErrOutputNotDir) {
+					t.Errorf("error = %v, want %v", r.Err, ErrOutputNotDir)
+				}
+			}
+			if data, err := os.ReadFile(file); err != nil || string(data) != "keep" {
+				t.Errorf("%s is changed to %q (%v)", tt.file, data, err)
+			}
+		})
+	}
+}
+
+func TestWebPKeepsAlpha(t *testing.T) {
+	// 左から透明、半透明、不透明の3つの帯に分かれた赤い画像。
+	src := image.NewNRGBA(image.Rect(0, 0, 200, 100))
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 200; x++ {
+			a := uint8(0)
+			if x >= 100 {
+				a = 255
+			} else if x >= 50 {
+				a = 128
+			}
+			src.SetNRGBA(x, y, color.NRGBA{200, 30, 30, a})
+		}
+	}
+	tests := []struct {
+		name string
+		opt  Options
+	}{
+		{"lossy", Options{Quality: 80}},
+		{"lossless", Options{WebPLossless: true}},
+		{"maxBytes", Options{MaxOutputBytes: 2000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			p := writePNG(t, dir, "t.png", src)
+			tt.opt.Width, tt.opt.OutFormat, tt.opt.OutputDir = 100, TYPE_WEBP, filepath.Join(dir, "out")
+			r, err := ResizeImage(p, tt.opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, format := decodeFile(t, r.OutputPath)
+			if format != "webp" {
+				t.Fatalf("output is %s", format)
+			}
+			for _, c := range []struct {
+				x         int
+				wantAlpha uint8
+			}{{10, 0}, {37, 128}, {90, 255}} {
+				got := color.NRGBAModel.Convert(out.At(c.x, 25)).(color.NRGBA)
+				if abs(int(got.A)-int(c.wantAlpha)) > 4 {
+					t.Errorf("alpha at %d = %d, want %d", c.x, got.A, c.wantAlpha)
+				}
+				// 乗算済みのまま渡すと、半透明の部分の色が暗くなる。
+				if c.wantAlpha > 0 && abs(int(got.R)-200) > 12 {
+					t.Errorf("pixel %d = %v, want red 200", c.x, got)
+				}
+			}
+		})
+	}
+}
+
+func TestWebPPremultipliedRGBA(t *testing.T) {
+	// circleで切り抜いた画像などは*image.RGBA(アルファを乗算済み)のまま渡される。
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.NRGBA{200, 30, 30, 128}), image.Point{}, draw.Src)
+	for _, lossless := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := encodeImage(&buf, img, TYPE_WEBP, Options{Quality: 90, WebPLossless: lossless}); err != nil {
+			t.Fatal(err)
+		}
+		out, err := webp.Decode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := color.NRGBAModel.Convert(out.At(8, 8)).(color.NRGBA)
+		if abs(int(got.R)-200) > 20 || abs(int(got.A)-128) > 4 {
+			t.Errorf("lossless=%v: pixel = %v, want about {200 30 30 128}", lossless, got)
+		}
+	}
+}
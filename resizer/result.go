@@ -0,0 +1,74 @@
+package resizer
+
+import (
+	"encoding/json"
+	"image"
+	"os"
+)
+
+// Result は1ファイル分のリサイズ結果です。
+type Result struct {
+	SourcePath   string `json:"sourcePath"`
+	OutputPath   string `json:"outputPath"`
+	SourceWidth  int    `json:"sourceWidth"`
+	SourceHeight int    `json:"sourceHeight"`
+	// SourceBytes は処理する前の入力ファイルのバイト数です。
+	SourceBytes int64  `json:"sourceBytes"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Format      string `json:"format"`
+	// Quality は出力に使った品質です。PNGや可逆WebPなど品質を使わない形式では0になります。
+	Quality int `json:"quality,omitempty"`
+	// Tiles はタイル分割したときに書き出したファイルです。この場合OutputPathには分割前の画像として出力した場合のパスが入り、ファイルは作られません。
+	Tiles []string `json:"tiles,omitempty"`
+	// Variants は-srcsetで書き出した幅ごとの画像です。この場合OutputPathなどには最も大きい幅の画像の情報が入ります。
+	Variants []SrcsetVariant `json:"variants,omitempty"`
+	// Preview は-previewで書き出した比較画像のパスです。
+	Preview string `json:"preview,omitempty"`
+	// Frames はアニメーションPNGとして出力したときのフレーム数です。静止画では0になります。
+	Frames int `json:"frames,omitempty"`
+	// Warnings は出力はできたものの注意が必要な点です。
+	Warnings []string `json:"warnings,omitempty"`
+	// Err はBatchResizeで失敗したファイルのエラーです。この場合SourcePath以外のフィールドは空になります。
+	Err error `json:"-"`
+}
+
+func newResult(srcPath, outPath string, cfg image.Config, w, h int, format string, opt Options) *Result {
+	r := &Result{
+		SourcePath:   srcPath,
+		OutputPath:   outPath,
+		SourceWidth:  cfg.Width,
+		SourceHeight: cfg.Height,
+		Width:        w,
+		Height:       h,
+		Format:       format,
+	}
+	if usesQuality(format, opt) {
+		r.Quality = qualityFor(format, opt)
+	}
+	return r
+}
+
+// OutputPaths はrで書き出した画像ファイルのパスを返します。
+func (r *Result) OutputPaths() []string {
+	if len(r.Tiles) > 0 {
+		return r.Tiles
+	}
+	if len(r.Variants) > 0 {
+		paths := make([]string, len(r.Variants))
+		for i, v := range r.Variants {
+			paths[i] = v.Path
+		}
+		return paths
+	}
+	return []string{r.OutputPath}
+}
+
+// WriteSidecarJSON は出力ファイルの隣に"出力ファイル名.json"としてrを書き出します。
+func WriteSidecarJSON(r *Result) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.OutputPath+".json", append(data, '\n'), 0644)
+}
@@ -0,0 +1,59 @@
+package resizer
+
+import (
+	"bytes"
+	"image"
+)
+
+// FORMAT_SMALLEST はOptions.OutFormatに指定すると、smallestCandidatesのうち最も小さくエンコードできた形式で出力します。
+const FORMAT_SMALLEST = "smallest"
+
+// smallestCandidates はFORMAT_SMALLESTで試す出力形式です。同じサイズの場合は先にあるものを優先します。
+var smallestCandidates = []string{TYPE_JPG, TYPE_WEBP, TYPE_PNG}
+
+// encodeSmallest はimgを各候補の形式でメモリ上にエンコードし、最もバイト数が小さい形式とそのデータ、使った品質を返します。
+// 不透明でない画素がある場合は、透過が失われるJPEGを候補から外します。
+// opt.SSIMが指定されている場合は、品質を使う形式ごとに品質を自動で決めてから比べます。
+func encodeSmallest(img image.Image, opt Options) (string, []byte, int, error) {
+	translucent := !isOpaque(img)
+	var bestFormat string
+	var best []byte
+	bestQuality := opt.Quality
+	for _, format := range smallestCandidates {
+		if translucent && format == TYPE_JPG {
+			continue
+		}
+		o := opt
+		if o.SSIM > 0 && usesQuality(format, o) {
+			q, err := searchQuality(img, format, o)
+			if err != nil {
+				return "", nil, 0, err
+			}
+			o.Quality = q
+		}
+		var buf bytes.Buffer
+		if err := encodeImage(&buf, img, format, o); err != nil {
+			return "", nil, 0, err
+		}
+		if best == nil || buf.Len() < len(best) {
+			bestFormat, best, bestQuality = format, buf.Bytes(), qualityFor(format, o)
+		}
+	}
+	return bestFormat, best, bestQuality, nil
+}
+
+// isOpaque は画像のすべての画素が不透明かどうかを返します。
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return false
+			}
+		}
+	}
+	return true
+}
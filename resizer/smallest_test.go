@@ -0,0 +1,64 @@
+package resizer
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+// noisy はJPEGが最も小さくなりやすい、色が細かく変わる不透明な画像を返します。
+func noisy(w, h int) *image.NRGBA {
+	rnd := rand.New(rand.NewSource(1))
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(rnd.Intn(256))
+	}
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255
+	}
+	return img
+}
+
+func TestSmallestKeepsTransparency(t *testing.T) {
+	tests := []struct {
+		name  string
+		alpha func(img *image.NRGBA)
+	}{
+		{"opaque", func(*image.NRGBA) {}},
+		{"one transparent pixel", func(img *image.NRGBA) {
+			img.SetNRGBA(0, 0, color.NRGBA{})
+		}},
+		{"transparent half", func(img *image.NRGBA) {
+			for y := 0; y < 128; y++ {
+				for x := 0; x < 64; x++ {
+					img.SetNRGBA(x, y, color.NRGBA{})
+				}
+			}
+		}},
+		{"translucent", func(img *image.NRGBA) {
+			for i := 3; i < len(img.Pix); i += 4 {
+				img.Pix[i] = 128
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := noisy(128, 128)
+			tt.alpha(img)
+			dir := t.TempDir()
+			src := writePNG(t, dir, "a.png", img)
+			r, err := ResizeImage(src, Options{Width: 64, OutFormat: FORMAT_SMALLEST, OutputDir: filepath.Join(dir, "out")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if opaque := img.Opaque(); opaque != (r.Format == TYPE_JPG) {
+				t.Fatalf("format = %s for a source with opaque=%v", r.Format, opaque)
+			}
+			if out, _ := decodeFile(t, r.OutputPath); !img.Opaque() && isOpaque(out) {
+				t.Errorf("%s output lost the transparency", r.Format)
+			}
+		})
+	}
+}
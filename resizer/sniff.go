@@ -0,0 +1,38 @@
+package resizer
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// otherImageFormats はデコードできないが画像として判別できる形式と、ファイルの先頭のシグネチャです。
+// offsetはシグネチャがファイルの先頭から何バイト目にあるかです。
+var otherImageFormats = []struct {
+	name   string
+	offset int
+	magic  string
+}{
+	{"gif", 0, "GIF87a"},
+	{"gif", 0, "GIF89a"},
+	{"bmp", 0, "BM"},
+	{"tiff", 0, "II*\x00"},
+	{"tiff", 0, "MM\x00*"},
+	{"ico", 0, "\x00\x00\x01\x00"},
+	{"psd", 0, "8BPS"},
+	{"jpeg xl", 0, "\xff\x0a"},
+	{"heif/avif", 4, "ftyp"},
+}
+
+// unknownFormatError はimage.DecodeConfigが形式を判別できなかったファイルについて、先頭のheaderから理由を判断してエラーを返します。
+// 画像として判別できる形式の場合はErrUnsupportedFormat、空のファイルや画像でない内容の場合はErrInvalidImageになります。
+func unknownFormatError(header []byte) error {
+	if len(header) == 0 {
+		return fmt.Errorf("%w: file is empty", ErrInvalidImage)
+	}
+	for _, f := range otherImageFormats {
+		if len(header) > f.offset && bytes.HasPrefix(header[f.offset:], []byte(f.magic)) {
+			return fmt.Errorf("%w: %s: This method only run jpeg and png", ErrUnsupportedFormat, f.name)
+		}
+	}
+	return fmt.Errorf("%w: unrecognized file contents", ErrInvalidImage)
+}
@@ -0,0 +1,36 @@
+package resizer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInvalidImageInputs(t *testing.T) {
+	tests := []struct {
+		name, data string
+		wantErr    error
+		notErr     error
+	}{
+		{"empty.jpg", "", ErrInvalidImage, ErrUnsupportedFormat},
+		{"empty.png", "", ErrInvalidImage, ErrUnsupportedFormat},
+		{"text.jpg", "hello, this is not a jpeg\n", ErrInvalidImage, ErrUnsupportedFormat},
+		{"text.png", "name,width\nphoto,800\n", ErrInvalidImage, ErrUnsupportedFormat},
+		{"gif.jpg", "GIF89a\x01\x00\x01\x00\x00\x00\x00;", ErrUnsupportedFormat, ErrInvalidImage},
+		{"truncated.jpg", "\xff\xd8\xff\xe0garbage", ErrDecode, ErrUnsupportedFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := filepath.Join(dir, tt.name)
+			if err := os.WriteFile(src, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := ResizeImage(src, Options{Width: 10, OutputDir: filepath.Join(dir, "out")})
+			if !errors.Is(err, tt.wantErr) || errors.Is(err, tt.notErr) {
+				t.Errorf("error = %v, want %v and not %v", err, tt.wantErr, tt.notErr)
+			}
+		})
+	}
+}
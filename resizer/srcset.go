@@ -0,0 +1,72 @@
+package resizer
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// SrcsetVariant は-srcsetで書き出した幅ごとの画像です。
+type SrcsetVariant struct {
+	Path   string `json:"path"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// ParseSrcset は"320,640,960"の形式の幅の一覧を、重複を除いて小さい順に返します。
+func ParseSrcset(s string) ([]int, error) {
+	var widths []int
+	for _, item := range strings.Split(s, ",") {
+		w, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil || w < 1 {
+			return nil, fmt.Errorf("%q is not a positive integer", item)
+		}
+		widths = append(widths, w)
+	}
+	slices.Sort(widths)
+	return slices.Compact(widths), nil
+}
+
+// resizeSrcset は読み込んだ画像を、opt.Srcsetの幅ごとに高さを縦横比から計算して縮小し、"名前_幅w.拡張子"として書き出します。
+// 元の画像より大きい幅は拡大しても意味がないため作らず、すべての幅が元の画像より大きい場合は元の幅の1枚だけを作ります。
+// 返すResultは最も大きい幅の画像のもので、Variantsに書き出したすべての画像が入ります。
+func resizeSrcset(ctx context.Context, srcPath string, imgSrc, scaleSrc image.Image, rctSrc image.Rectangle, cfg image.Config, t string, opt Options) (*Result, error) {
+	var widths, skipped []int
+	for _, w := range opt.Srcset {
+		if w <= rctSrc.Dx() {
+			widths = append(widths, w)
+		} else {
+			skipped = append(skipped, w)
+		}
+	}
+	var warnings []string
+	if len(skipped) > 0 {
+		warnings = append(warnings, fmt.Sprintf("srcset widths %v are larger than the source width %d and are not generated", skipped, rctSrc.Dx()))
+	}
+	if len(widths) == 0 {
+		widths = []int{rctSrc.Dx()}
+	}
+
+	var result *Result
+	var variants []SrcsetVariant
+	for _, w := range widths {
+		vOpt := opt
+		vOpt.Srcset = nil
+		vOpt.Width, vOpt.Height = w, 0
+		vOpt.Megapixels, vOpt.ScaleX, vOpt.ScaleY = 0, 0, 0
+		vOpt.Suffix = fmt.Sprintf("%s_%dw", opt.Suffix, w)
+		r, err := resizeDecoded(ctx, srcPath, imgSrc, scaleSrc, rctSrc, cfg, t, func() {}, vOpt)
+		if err != nil {
+			return nil, fmt.Errorf("srcset width %d: %w", w, err)
+		}
+		variants = append(variants, SrcsetVariant{Path: r.OutputPath, Width: r.Width, Height: r.Height})
+		warnings = append(warnings, r.Warnings...)
+		result = r
+	}
+	result.Variants = variants
+	result.Warnings = warnings
+	return result, nil
+}
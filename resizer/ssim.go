@@ -0,0 +1,104 @@
+package resizer
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+
+	"golang.org/x/image/webp"
+)
+
+// DefaultSSIM は-quality autoで目標とするSSIMの既定値です。
+const DefaultSSIM = 0.98
+
+// ssimWindow はSSIMを計算する正方形の窓の一辺です。窓は重ならないように並べます。
+const ssimWindow = 8
+
+// usesQuality は出力形式が品質の指定を使うかどうかを返します。
+func usesQuality(format string, opt Options) bool {
+	return format == TYPE_JPG || (format == TYPE_WEBP && !opt.WebPLossless)
+}
+
+// searchQuality はimgをformatでエンコードしたときに、元の画像とのSSIMがopt.SSIM以上になる最も低い品質を返します。
+// 品質1〜100を二分探索するため、エンコードとデコードは最大7回です。100でも届かない場合は100を返します。
+func searchQuality(img image.Image, format string, opt Options) (int, error) {
+	ref := luminance(img)
+	lo, hi := 1, 100
+	for lo < hi {
+		q := (lo + hi) / 2
+		o := opt
+		o.Quality = q
+		var buf bytes.Buffer
+		if err := encodeImage(&buf, img, format, o); err != nil {
+			return 0, err
+		}
+		var decoded image.Image
+		var err error
+		if format == TYPE_JPG {
+			decoded, err = jpeg.Decode(&buf)
+		} else {
+			decoded, err = webp.Decode(&buf)
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if ssim(ref, luminance(decoded), img.Bounds().Dx(), img.Bounds().Dy()) >= opt.SSIM {
+			hi = q
+		} else {
+			lo = q + 1
+		}
+	}
+	return lo, nil
+}
+
+// luminance は画像の輝度(ITU-R BT.601、0〜255)を左上から行ごとに並べて返します。
+// アルファ乗算済みの値を使うため、透明な部分は黒として扱われます。
+func luminance(img image.Image) []float64 {
+	b := img.Bounds()
+	y := make([]float64, 0, b.Dx()*b.Dy())
+	for py := b.Min.Y; py < b.Max.Y; py++ {
+		for px := b.Min.X; px < b.Max.X; px++ {
+			r, g, bl, _ := img.At(px, py).RGBA()
+			y = append(y, (0.299*float64(r)+0.587*float64(g)+0.114*float64(bl))/0x101)
+		}
+	}
+	return y
+}
+
+// ssim は幅w、高さhの輝度a, bについて、ssimWindow四方の窓ごとのSSIMの平均を返します。
+// 画像が窓より小さい場合は画像全体を1つの窓とします。
+func ssim(a, b []float64, w, h int) float64 {
+	const (
+		c1 = (0.01 * 255) * (0.01 * 255)
+		c2 = (0.03 * 255) * (0.03 * 255)
+	)
+	win := min(ssimWindow, w, h)
+	var total float64
+	var count int
+	for y0 := 0; y0+win <= h; y0 += win {
+		for x0 := 0; x0+win <= w; x0 += win {
+			var sa, sb, saa, sbb, sab float64
+			for y := y0; y < y0+win; y++ {
+				for x := x0; x < x0+win; x++ {
+					va, vb := a[y*w+x], b[y*w+x]
+					sa += va
+					sb += vb
+					saa += va * va
+					sbb += vb * vb
+					sab += va * vb
+				}
+			}
+			n := float64(win * win)
+			ma, mb := sa/n, sb/n
+			varA, varB := saa/n-ma*ma, sbb/n-mb*mb
+			cov := sab/n - ma*mb
+			total += ((2*ma*mb + c1) * (2*cov + c2)) / ((ma*ma + mb*mb + c1) * (varA + varB + c2))
+			count++
+		}
+	}
+	if count == 0 {
+		return 1
+	}
+	return total / float64(count)
+}
@@ -0,0 +1,163 @@
+package resizer
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"golang.org/x/image/draw"
+)
+
+// stripRows は帯ごとに縮小する場合に、一度にRGBAへ変換する元の画像の行数です。
+const stripRows = 64
+
+// kernelTap は縮小後の1画素に寄与する元の画素の位置と重みです。
+type kernelTap struct {
+	index  int
+	weight float64
+}
+
+// kernelWeights はsn画素をdn画素に縮小・拡大するときの、縮小後の各画素に寄与する元の画素と正規化した重みを返します。
+// golang.org/x/image/drawのKernel.Scaleと同じく、縮小する場合はカーネルの幅を縮小率に合わせて広げます。
+func kernelWeights(k *draw.Kernel, dn, sn int) [][]kernelTap {
+	scale := float64(sn) / float64(dn)
+	halfWidth, argScale := k.Support, 1.0
+	if scale > 1 {
+		halfWidth *= scale
+		argScale = 1 / scale
+	}
+	taps := make([][]kernelTap, dn)
+	for d := range taps {
+		center := (float64(d)+0.5)*scale - 0.5
+		lo := max(0, int(math.Floor(center-halfWidth)))
+		hi := min(sn, int(math.Ceil(center+halfWidth)))
+		total := 0.0
+		for s := lo; s < hi; s++ {
+			t := math.Abs((center - float64(s)) * argScale)
+			if t >= k.Support {
+				continue
+			}
+			if w := k.At(t); w != 0 {
+				taps[d] = append(taps[d], kernelTap{s, w})
+				total += w
+			}
+		}
+		for i := range taps[d] {
+			taps[d][i].weight /= total
+		}
+	}
+	return taps
+}
+
+// scaleStrips はsrcのsrの範囲をkで縮小してdstに描画します(draw.Srcとして描画します)。
+// Kernel.Scaleは元の画像全体の行を横方向に縮小した中間結果を保持し、YCbCrの画像ではRGBAへの変換も画像全体で行いますが、
+// ここでは元の画像を上からstripRows行ずつRGBAに変換し、縦方向の縮小に必要な行だけを残しながら縮小します。
+// srcはデコード済みの画像全体のため、デコード結果の分のメモリは減りません。減るのはRGBAに変換した画像全体の複製
+// (4:2:0のJPEGではデコード結果の約2.7倍)と、元の高さ×縮小後の幅の中間結果の分で、代わりに帯の大きさ程度のメモリを使います。
+func scaleStrips(dst draw.RGBA64Image, src image.Image, sr image.Rectangle, k *draw.Kernel) {
+	dr := dst.Bounds()
+	xTaps := kernelWeights(k, dr.Dx(), sr.Dx())
+	yTaps := kernelWeights(k, dr.Dy(), sr.Dy())
+
+	// rowsは横方向に縮小した元の画像の行で、rows[i]がsr内のbase+i行目にあたる。捨てた行はfreeに入れて使い回す。
+	var rows, free [][][4]float64
+	base, next := 0, 0
+	var strip image.RGBA64Image
+	stripEnd := 0
+	line := make([][4]float64, sr.Dx())
+
+	for dy, taps := range yTaps {
+		if len(taps) == 0 {
+			continue
+		}
+		// この行に必要な元の行がそろうまで、横方向に縮小した行を追加する。
+		for needed := taps[len(taps)-1].index + 1; next < needed; next++ {
+			if next >= stripEnd {
+				stripEnd = min(sr.Dy(), next+stripRows)
+				strip = rgbaStrip(src, image.Rect(sr.Min.X, sr.Min.Y+next, sr.Max.X, sr.Min.Y+stripEnd))
+			}
+			y := sr.Min.Y + next
+			for x := range line {
+				c := strip.RGBA64At(sr.Min.X+x, y)
+				line[x] = [4]float64{float64(c.R), float64(c.G), float64(c.B), float64(c.A)}
+			}
+			var row [][4]float64
+			if n := len(free); n > 0 {
+				row, free = free[n-1], free[:n-1]
+			} else {
+				row = make([][4]float64, dr.Dx())
+			}
+			for dx, xt := range xTaps {
+				var p [4]float64
+				for _, t := range xt {
+					c := line[t.index]
+					p[0] += c[0] * t.weight
+					p[1] += c[1] * t.weight
+					p[2] += c[2] * t.weight
+					p[3] += c[3] * t.weight
+				}
+				row[dx] = p
+			}
+			rows = append(rows, row)
+		}
+
+		for dx := 0; dx < dr.Dx(); dx++ {
+			var p [4]float64
+			for _, t := range taps {
+				c := rows[t.index-base][dx]
+				p[0] += c[0] * t.weight
+				p[1] += c[1] * t.weight
+				p[2] += c[2] * t.weight
+				p[3] += c[3] * t.weight
+			}
+			a := clamp16(p[3])
+			dst.SetRGBA64(dr.Min.X+dx, dr.Min.Y+dy, color.RGBA64{
+				R: min(clamp16(p[0]), a),
+				G: min(clamp16(p[1]), a),
+				B: min(clamp16(p[2]), a),
+				A: a,
+			})
+		}
+
+		// 次の行で使わない元の行は捨てる。
+		if dy+1 < len(yTaps) && len(yTaps[dy+1]) > 0 {
+			if drop := yTaps[dy+1][0].index - base; drop > 0 {
+				free = append(free, rows[:drop]...)
+				rows = append(rows[:0:0], rows[drop:]...)
+				base += drop
+			}
+		}
+	}
+}
+
+// rgbaStrip はsrcのrの範囲の行を取り出します。色差がサブサンプリングされたYCbCrの画像は、
+// fullColorと同じく色差を補間した*image.RGBAにします。帯の境目で補間の結果が変わらないよう、
+// 周りに色差の画素2つ分の余白を付けて変換します。
+func rgbaStrip(src image.Image, r image.Rectangle) image.RGBA64Image {
+	ycc, ok := src.(*image.YCbCr)
+	if !ok {
+		if img, ok := src.(image.RGBA64Image); ok {
+			return img
+		}
+		strip := image.NewRGBA64(r)
+		draw.Draw(strip, r, src, r.Min, draw.Src)
+		return strip
+	}
+	if ycc.SubsampleRatio == image.YCbCrSubsampleRatio444 {
+		return ycc
+	}
+	fx, fy := chromaFactors(ycc.SubsampleRatio)
+	margin := image.Rect((r.Min.X/fx-2)*fx, (r.Min.Y/fy-2)*fy, (r.Max.X/fx+3)*fx, (r.Max.Y/fy+3)*fy)
+	return upsampleYCbCr(ycc.SubImage(margin.Intersect(ycc.Rect)).(*image.YCbCr))
+}
+
+// clamp16 はvを四捨五入して0〜0xffffに収めます。
+func clamp16(v float64) uint16 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 0xffff {
+		return 0xffff
+	}
+	return uint16(v + 0.5)
+}
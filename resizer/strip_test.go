@@ -0,0 +1,152 @@
+package resizer
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"testing"
+	"time"
+
+	"golang.org/x/image/draw"
+)
+
+func TestScaleStripsMatchesKernelScale(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	src := image.NewNRGBA(image.Rect(0, 0, 997, 211))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(rnd.Intn(256))
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, src, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	ycc, err := jpeg.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		src  image.Image
+		k    *draw.Kernel
+		w, h int
+	}{
+		{"ycbcr catmullrom", ycc, draw.CatmullRom, 100, 21},
+		{"ycbcr lanczos3", ycc, lanczosKernel(3), 300, 50},
+		{"ycbcr almost full size", ycc, draw.CatmullRom, 996, 210},
+		{"nrgba catmullrom", src, draw.CatmullRom, 300, 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := image.NewRGBA64(image.Rect(0, 0, tt.w, tt.h))
+			tt.k.Scale(want, want.Rect, fullColor(tt.src), tt.src.Bounds(), draw.Over, nil)
+			got := image.NewRGBA64(want.Rect)
+			scaleStrips(got, tt.src, tt.src.Bounds(), tt.k)
+			// 16bitの値で、丸めの違いの分だけ異なることがある。
+			for i := range got.Pix {
+				if d := abs(int(got.Pix[i]) - int(want.Pix[i])); d > 1 {
+					t.Fatalf("byte %d differs by %d", i, d)
+				}
+			}
+		})
+	}
+}
+
+// peakHeap はfを実行している間のヒープ上のオブジェクトの大きさの最大値を、1msおきに調べて返します。
+// 実行前にGCし、GCの頻度を上げて、回収されていないオブジェクトがなるべく含まれないようにします。
+func peakHeap(f func()) uint64 {
+	defer debug.SetGCPercent(debug.SetGCPercent(10))
+	runtime.GC()
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	var peak uint64
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		tick := time.NewTicker(time.Millisecond)
+		defer tick.Stop()
+		for {
+			metrics.Read(sample)
+			peak = max(peak, sample[0].Value.Uint64())
+			select {
+			case <-done:
+				return
+			case <-tick.C:
+			}
+		}
+	}()
+	f()
+	close(done)
+	<-stopped
+	return peak
+}
+
+// BenchmarkStripScale は横に長いJPEGの縮小を、画像全体をRGBAにしてから縮小する場合とStripScaleの場合で比べます。
+// decodeはデコードだけを行う場合で、StripScaleでも下回れないメモリ使用量の下限です。
+// B/opは確保したメモリの合計のため、帯ごとに確保し直すStripScaleでは減りません。
+// 減るのは同時に使うメモリで、最後に1回だけ実行して、その間のヒープの最大値をpeak-MiBとして出力します。
+// どれもデコード結果の分(この画像では約9MiB)を含み、元の画像が大きくなるとその分だけ増えます。
+func BenchmarkStripScale(b *testing.B) {
+	img := image.NewYCbCr(image.Rect(0, 0, 8000, 800), image.YCbCrSubsampleRatio420)
+	for i := range img.Y {
+		img.Y[i] = uint8(i * 7)
+	}
+	for i := range img.Cb {
+		img.Cb[i], img.Cr[i] = uint8(i/3), uint8(i/5)
+	}
+	src := filepath.Join(b.TempDir(), "pano.jpg")
+	f, err := os.Create(src)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := jpeg.Encode(f, img, &jpeg.Options{Quality: 90}); err != nil {
+		b.Fatal(err)
+	}
+	f.Close()
+
+	resize := func(strip bool) func() error {
+		opt := Options{
+			Width:      800,
+			StripScale: strip,
+			NewOutput:  func(path string) (OutputWriter, error) { return NopCommitter(io.Discard, path), nil },
+		}
+		return func() error {
+			_, err := ResizeImage(src, opt)
+			return err
+		}
+	}
+	decode := func() error {
+		f, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = jpeg.Decode(f)
+		return err
+	}
+	for _, bm := range []struct {
+		name string
+		run  func() error
+	}{{"decode", decode}, {"full", resize(false)}, {"strip", resize(true)}} {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := bm.run(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			peak := peakHeap(func() {
+				if err := bm.run(); err != nil {
+					b.Fatal(err)
+				}
+			})
+			b.ReportMetric(float64(peak)/(1<<20), "peak-MiB")
+		})
+	}
+}
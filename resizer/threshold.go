@@ -0,0 +1,34 @@
+package resizer
+
+import (
+	"image"
+	"os"
+)
+
+// exceedsThreshold はsrcPathがopt.OnlyLargerThanBytes, opt.OnlyWiderThanのいずれかを超えているかどうかを返します。
+// 両方を指定した場合はどちらか一方を超えていれば処理の対象とします。画像全体はデコードせず、幅はヘッダから読み取ります。
+// ヘッダを読み取れない場合は対象とし、リサイズの処理でエラーを報告させます。
+func exceedsThreshold(srcPath string, opt Options) (bool, error) {
+	f, err := os.Open(srcPath)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	if opt.OnlyLargerThanBytes > 0 {
+		info, err := f.Stat()
+		if err != nil {
+			return false, err
+		}
+		if info.Size() > opt.OnlyLargerThanBytes {
+			return true, nil
+		}
+	}
+	if opt.OnlyWiderThan > 0 {
+		cfg, _, err := image.DecodeConfig(f)
+		if err != nil || cfg.Width > opt.OnlyWiderThan {
+			return true, nil
+		}
+	}
+	return false, nil
+}
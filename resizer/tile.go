@@ -0,0 +1,44 @@
+package resizer
+
+import (
+	"context"
+	"fmt"
+	"image"
+)
+
+// writeTiles はimgをopt.Tile四方のタイルに分割し、"名前_r行_c列.拡張子"のファイルとして書き出します。
+// 書き出したファイルのパスを左上から行ごとの順に返します。
+func writeTiles(ctx context.Context, img image.Image, srcPath, ext, format string, opt Options) ([]string, error) {
+	sub, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	})
+	if !ok {
+		return nil, fmt.Errorf("cannot split %T into tiles", img)
+	}
+
+	b := img.Bounds()
+	var paths []string
+	for row, y := 0, b.Min.Y; y < b.Max.Y; row, y = row+1, y+opt.Tile {
+		for col, x := 0, b.Min.X; x < b.Max.X; col, x = col+1, x+opt.Tile {
+			r := image.Rect(x, y, x+opt.Tile, y+opt.Tile).Intersect(b)
+			suffix := fmt.Sprintf("%s_r%d_c%d", opt.Suffix, row, col)
+			dst, err := createOutput(ctx, srcPath, outName(srcPath, suffix, ext, opt), opt)
+			if err != nil {
+				return paths, err
+			}
+			err = encodeImage(dst, sub.SubImage(r), format, opt)
+			if err == nil {
+				err = dst.Commit()
+			}
+			dst.Close()
+			if err == nil && opt.VerifyOutput && opt.NewOutput == nil {
+				err = verifyOutput(dst.Name(), r.Dx(), r.Dy())
+			}
+			if err != nil {
+				return paths, err
+			}
+			paths = append(paths, dst.Name())
+		}
+	}
+	return paths, nil
+}
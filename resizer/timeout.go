@@ -0,0 +1,54 @@
+package resizer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ctxReader はctxがキャンセルされた後のReadでctxのエラーを返すio.Readerです。
+// デコーダは少しずつ読み込むため、これを挟むことでデコードの途中でも中断できます。
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *ctxReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// resizeWithTimeout はtimeoutを期限としてResizeImageContextを実行します。
+// 期限を過ぎた場合は処理が次の区切りで中断するのを待ってからタイムアウトのエラーを返します。出力ファイルは確定されません。
+// 処理が終わるまで戻らないため、タイムアウトしたファイルの処理が残って同時に処理するファイルの数が増えることはありません。
+// parentがキャンセルされた場合や、parentの期限を過ぎた場合も同様に中断し、parentのエラーを返します。
+func resizeWithTimeout(parent context.Context, srcPath string, opt Options, timeout time.Duration) (*Result, error) {
+	_, hasDeadline := parent.Deadline()
+	if timeout <= 0 && !hasDeadline {
+		return ResizeImageContext(parent, srcPath, opt)
+	}
+
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
+	defer cancel()
+
+	// 期限を過ぎる前に出力を確定できた場合は、成功した結果をそのまま返す。
+	result, err := ResizeImageContext(ctx, srcPath, opt)
+	if err == nil || ctx.Err() == nil {
+		return result, err
+	}
+	if err := parent.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("timed out after %s: %w", timeout, ctx.Err())
+}
@@ -0,0 +1,26 @@
+package resizer
+
+import "image"
+
+// opaqueBounds はimgのうちアルファが0でない画素をすべて含む最小の矩形を返します。
+// 透過を持たない画像や、すべての画素が透明な画像ではimgの範囲をそのまま返します。
+func opaqueBounds(img image.Image) image.Rectangle {
+	b := img.Bounds()
+	if isOpaque(img) {
+		return b
+	}
+
+	r := image.Rectangle{}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a == 0 {
+				continue
+			}
+			r = r.Union(image.Rect(x, y, x+1, y+1))
+		}
+	}
+	if r.Empty() {
+		return b
+	}
+	return r
+}
@@ -0,0 +1,72 @@
+package resizer
+
+import (
+	"image"
+	"image/color"
+	"path/filepath"
+	"testing"
+)
+
+// sprite はw×hの透明な画像のcontentの範囲だけを半透明の青で塗った画像を返します。
+func sprite(w, h int, content image.Rectangle) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := content.Min.Y; y < content.Max.Y; y++ {
+		for x := content.Min.X; x < content.Max.X; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{0, 0, 255, 128})
+		}
+	}
+	return img
+}
+
+func TestOpaqueBounds(t *testing.T) {
+	tests := []struct {
+		name string
+		img  image.Image
+		want image.Rectangle
+	}{
+		{"asymmetric margins", sprite(100, 80, image.Rect(5, 10, 45, 30)), image.Rect(5, 10, 45, 30)},
+		{"touching right and bottom", sprite(100, 80, image.Rect(60, 50, 100, 80)), image.Rect(60, 50, 100, 80)},
+		{"single pixel", sprite(100, 80, image.Rect(99, 0, 100, 1)), image.Rect(99, 0, 100, 1)},
+		{"all transparent", sprite(100, 80, image.Rectangle{}), image.Rect(0, 0, 100, 80)},
+		{"opaque", gradient(100, 80), image.Rect(0, 0, 100, 80)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := opaqueBounds(tt.img); got != tt.want {
+				t.Errorf("opaqueBounds = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrimTransparentResize(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      image.Rectangle
+		width        int
+		wantW, wantH int
+	}{
+		{"wide content", image.Rect(5, 10, 45, 30), 20, 20, 10},
+		{"tall content", image.Rect(70, 2, 80, 62), 5, 5, 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			src := writePNG(t, dir, "s.png", sprite(100, 80, tt.content))
+			r, err := ResizeImage(src, Options{Width: tt.width, TrimTransparent: true, OutputDir: filepath.Join(dir, "out")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Width != tt.wantW || r.Height != tt.wantH {
+				t.Fatalf("size = %dx%d, want %dx%d", r.Width, r.Height, tt.wantW, tt.wantH)
+			}
+			// 透明な余白を残していなければ、四隅まで塗られている。
+			out, _ := decodeFile(t, r.OutputPath)
+			for _, p := range []image.Point{{0, 0}, {tt.wantW - 1, 0}, {0, tt.wantH - 1}, {tt.wantW - 1, tt.wantH - 1}} {
+				if _, _, _, a := out.At(p.X, p.Y).RGBA(); a == 0 {
+					t.Errorf("corner %v is transparent", p)
+				}
+			}
+		})
+	}
+}
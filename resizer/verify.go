@@ -0,0 +1,66 @@
+package resizer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+)
+
+// verifyOutput はpathに書き出した画像を読み込み直してデコードし、w, hが0より大きい場合は幅・高さがw×hであることを確かめます。
+func verifyOutput(path string, w, h int) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrVerifyFailed, err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(bufio.NewReader(f))
+	if err != nil {
+		return fmt.Errorf("%w: %s cannot be decoded: %w", ErrVerifyFailed, path, err)
+	}
+	if b := img.Bounds(); w > 0 && h > 0 && (b.Dx() != w || b.Dy() != h) {
+		return fmt.Errorf("%w: %s is %dx%d, expected %dx%d", ErrVerifyFailed, path, b.Dx(), b.Dy(), w, h)
+	}
+	return nil
+}
+
+// verifyICO はpathに書き出したICOファイルを読み込み直し、各エントリのPNGがデコードでき、エントリに書いたサイズと一致することを確かめます。
+func verifyICO(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrVerifyFailed, err)
+	}
+	if len(data) < 6 || binary.LittleEndian.Uint16(data[2:]) != 1 {
+		return fmt.Errorf("%w: %s has no icon header", ErrVerifyFailed, path)
+	}
+	n := int(binary.LittleEndian.Uint16(data[4:]))
+	if len(data) < 6+16*n {
+		return fmt.Errorf("%w: %s is truncated", ErrVerifyFailed, path)
+	}
+	for i := 0; i < n; i++ {
+		e := data[6+16*i:]
+		w, h := int(e[0]), int(e[1])
+		// 256pxは0で表される。
+		if w == 0 {
+			w = 256
+		}
+		if h == 0 {
+			h = 256
+		}
+		size, offset := binary.LittleEndian.Uint32(e[8:]), binary.LittleEndian.Uint32(e[12:])
+		if uint64(offset)+uint64(size) > uint64(len(data)) {
+			return fmt.Errorf("%w: %s entry %d is out of range", ErrVerifyFailed, path, i)
+		}
+		img, err := png.Decode(bytes.NewReader(data[offset : offset+size]))
+		if err != nil {
+			return fmt.Errorf("%w: %s entry %d cannot be decoded: %w", ErrVerifyFailed, path, i, err)
+		}
+		if b := img.Bounds(); b.Dx() != w || b.Dy() != h {
+			return fmt.Errorf("%w: %s entry %d is %dx%d, expected %dx%d", ErrVerifyFailed, path, i, b.Dx(), b.Dy(), w, h)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/chikin14niwa/image-resizer/resizer"
+)
+
+// batchStats は-statsで表示するバッチ全体の集計です。
+type batchStats struct {
+	start     time.Time
+	succeeded int
+	failed    int
+	skipped   int
+	small     int
+	bytesIn   int64
+	bytesOut  int64
+}
+
+func newBatchStats() *batchStats {
+	return &batchStats{start: time.Now()}
+}
+
+// add は1ファイル分の結果を集計に加えます。失敗したファイルは入力のサイズも数えません。
+// 入力のサイズには、replaceで入力ファイルが出力に置き換わった後でも正しい値になるよう、処理する前に取得したr.SourceBytesを使います。
+func (s *batchStats) add(r *resizer.Result, err error) {
+	if err != nil {
+		s.failed++
+		return
+	}
+	s.succeeded++
+	s.bytesIn += r.SourceBytes
+	for _, p := range r.OutputPaths() {
+		s.bytesOut += fileSize(p)
+	}
+}
+
+// print は集計結果をwに書き出します。時間はバッチ開始からの経過時間(実時間)です。
+func (s *batchStats) print(w io.Writer) {
+	elapsed := time.Since(s.start)
+	total := s.succeeded + s.failed
+	fmt.Fprintf(w, "処理ファイル数: %d (成功 %d, 失敗 %d", total, s.succeeded, s.failed)
+	if s.skipped > 0 {
+		fmt.Fprintf(w, ", 対応していない形式のため読み飛ばし %d", s.skipped)
+	}
+	if s.small > 0 {
+		fmt.Fprintf(w, ", しきい値以下のため読み飛ばし %d", s.small)
+	}
+	fmt.Fprintln(w, ")")
+	fmt.Fprintf(w, "入力合計: %d bytes, 出力合計: %d bytes\n", s.bytesIn, s.bytesOut)
+	fmt.Fprintf(w, "経過時間: %s", elapsed.Round(time.Millisecond))
+	if total > 0 {
+		fmt.Fprintf(w, " (1ファイルあたり平均 %s)", (elapsed / time.Duration(total)).Round(time.Millisecond))
+	}
+	fmt.Fprintln(w)
+}
+
+// fileSize はファイルのバイト数を返します。取得できない場合は0です。
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}